@@ -0,0 +1,312 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/markponce/greenlight/internal/data"
+	"github.com/markponce/greenlight/internal/validator"
+)
+
+const (
+	// bulkMaxOperations is the most operations accepted in a single bulk request.
+	bulkMaxOperations = 1000
+	// bulkMaxBytes is the size limit for bulk request bodies, which is higher than the
+	// usual 1MB to make room for bulkMaxOperations movies.
+	bulkMaxBytes = 10 * 1_048_576
+)
+
+// bulkBadRequestError wraps errors caused by a malformed operation, which would have
+// resulted in a 400 Bad Request response if sent as a single-movie request.
+type bulkBadRequestError struct {
+	err error
+}
+
+func (e bulkBadRequestError) Error() string {
+	return e.err.Error()
+}
+
+// bulkResult reports the outcome of a single operation in a bulk request, using the
+// status code that the equivalent single-movie request would have returned.
+type bulkResult struct {
+	Index  int               `json:"index"`
+	Op     string            `json:"op"`
+	Status int               `json:"status"`
+	Movie  *data.Movie       `json:"movie,omitempty"`
+	Errors map[string]string `json:"errors,omitempty"`
+	Error  string            `json:"error,omitempty"`
+}
+
+func (app *application) bulkMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	// In "transaction" mode (the default) the operations are all applied or none are,
+	// while in "per_item" mode each one is applied independently of the others.
+	var input struct {
+		Mode       string `json:"mode"`
+		Operations []struct {
+			Op      string          `json:"op"`
+			ID      int64           `json:"id"`
+			Version int32           `json:"version"`
+			Movie   json.RawMessage `json:"movie"`
+		} `json:"operations"`
+	}
+
+	err := app.readJSONWithLimit(w, r, &input, bulkMaxBytes)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Mode == "" {
+		input.Mode = "transaction"
+	}
+
+	v := validator.New()
+
+	v.Check(validator.PermittedValue(input.Mode, "transaction", "per_item"), "mode", "must be either transaction or per_item")
+	v.Check(len(input.Operations) >= 1, "operations", "must contain at least 1 operation")
+	v.Check(len(input.Operations) <= bulkMaxOperations, "operations", "must not contain more than 1000 operations")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Turn each operation into a data.MovieOperation, validating it as we go. Any
+	// operations which fail are recorded in the results straight away.
+	ops := make([]*data.MovieOperation, len(input.Operations))
+	results := make([]*bulkResult, len(input.Operations))
+	prepared := true
+
+	taxonomy, err := app.models.Genres.Taxonomy()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	for i, in := range input.Operations {
+		result := &bulkResult{Index: i, Op: in.Op}
+		results[i] = result
+
+		op, errs, err := app.prepareMovieOperation(in.Op, in.ID, in.Version, in.Movie, taxonomy)
+		switch {
+		case err != nil:
+			result.Status, result.Error = app.bulkErrorStatus(r, err)
+			prepared = false
+		case errs != nil:
+			result.Status, result.Errors = http.StatusUnprocessableEntity, errs
+			prepared = false
+		default:
+			ops[i] = op
+		}
+	}
+
+	user := app.contextGetUser(r)
+
+	if input.Mode == "per_item" {
+		for i, op := range ops {
+			if op == nil {
+				continue
+			}
+
+			err := app.models.Movies.Apply(op, user.ID)
+			app.recordBulkResult(r, results[i], op, err)
+		}
+
+		err = app.writeJSON(w, http.StatusOK, envelop{"results": results}, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// In transaction mode nothing is applied unless every operation is valid, and if
+	// any of them then fails the whole transaction is rolled back.
+	failed := -1
+
+	if prepared {
+		failed, err = app.models.Movies.ApplyAll(ops, user.ID)
+		if failed == -1 && err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		if failed != -1 {
+			app.recordBulkResult(r, results[failed], ops[failed], err)
+		}
+	}
+
+	if !prepared || failed != -1 {
+		for _, result := range results {
+			if result.Status == 0 {
+				result.Status = http.StatusFailedDependency
+				result.Error = "not applied because another operation failed"
+			}
+		}
+
+		app.errorResponse(w, r, http.StatusUnprocessableEntity, envelop{
+			"message": "no operations were applied because at least one of them failed",
+			"results": results,
+		})
+		return
+	}
+
+	for i, op := range ops {
+		app.recordBulkResult(r, results[i], op, nil)
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelop{"results": results}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// prepareMovieOperation builds and validates a single bulk operation. Creates take a
+// complete movie, while updates take only the fields to change, like a PATCH
+// request. It returns either the operation, the validation errors, or an error which
+// stopped the operation from being built at all.
+func (app *application) prepareMovieOperation(kind string, id int64, version int32, raw json.RawMessage, taxonomy data.Taxonomy) (*data.MovieOperation, map[string]string, error) {
+	v := validator.New()
+
+	op := &data.MovieOperation{Op: kind, ID: id, Version: version}
+
+	switch kind {
+	case data.OperationCreate:
+		var input movieInput
+
+		if v.Check(len(raw) > 0, "movie", "must be provided"); !v.Valid() {
+			return nil, v.Errors, nil
+		}
+
+		err := app.decodeJSON(bytes.NewReader(raw), &input)
+		if err != nil {
+			return nil, nil, bulkBadRequestError{err}
+		}
+
+		op.Movie = &data.Movie{
+			Title:     input.Title,
+			Year:      input.Year,
+			Runtime:   input.Runtime,
+			Genres:    input.Genres,
+			Status:    input.Status,
+			PublishAt: input.PublishAt,
+		}
+
+	case data.OperationUpdate:
+		var input struct {
+			Title     *string       `json:"title"`
+			Year      *int32        `json:"year"`
+			Runtime   *data.Runtime `json:"runtime"`
+			Genres    []string      `json:"genres"`
+			Status    *string       `json:"status"`
+			PublishAt *time.Time    `json:"publish_at"`
+		}
+
+		v.Check(id > 0, "id", "must be provided")
+		v.Check(len(raw) > 0, "movie", "must be provided")
+
+		if !v.Valid() {
+			return nil, v.Errors, nil
+		}
+
+		err := app.decodeJSON(bytes.NewReader(raw), &input)
+		if err != nil {
+			return nil, nil, bulkBadRequestError{err}
+		}
+
+		movie, err := app.models.Movies.Get(id)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		// If the client gave a version, the update only succeeds if the movie is still
+		// at that version.
+		if version != 0 {
+			movie.Vesion = version
+		}
+
+		if input.Title != nil {
+			movie.Title = *input.Title
+		}
+
+		if input.Year != nil {
+			movie.Year = *input.Year
+		}
+
+		if input.Runtime != nil {
+			movie.Runtime = *input.Runtime
+		}
+
+		if input.Genres != nil {
+			movie.Genres = input.Genres
+		}
+
+		if input.Status != nil {
+			movie.Status = *input.Status
+		}
+
+		if input.PublishAt != nil {
+			movie.PublishAt = input.PublishAt
+		}
+
+		op.Movie = movie
+
+	case data.OperationDelete:
+		v.Check(id > 0, "id", "must be provided")
+		v.Check(len(raw) == 0, "movie", "must not be provided for deletes")
+
+		if !v.Valid() {
+			return nil, v.Errors, nil
+		}
+
+		return op, nil, nil
+
+	default:
+		v.AddError("op", "must be one of create, update or delete")
+		return nil, v.Errors, nil
+	}
+
+	if data.ValidateMovie(v, op.Movie, taxonomy); !v.Valid() {
+		return nil, v.Errors, nil
+	}
+
+	return op, nil, nil
+}
+
+// recordBulkResult fills in the result of an operation once it has been applied.
+func (app *application) recordBulkResult(r *http.Request, result *bulkResult, op *data.MovieOperation, err error) {
+	if err != nil {
+		result.Status, result.Error = app.bulkErrorStatus(r, err)
+		return
+	}
+
+	switch op.Op {
+	case data.OperationCreate:
+		result.Status = http.StatusCreated
+		result.Movie = op.Movie
+	case data.OperationUpdate:
+		result.Status = http.StatusOK
+		result.Movie = op.Movie
+	default:
+		result.Status = http.StatusOK
+	}
+}
+
+// bulkErrorStatus maps an error from a single operation to the status code and
+// message that the equivalent single-movie request would have responded with.
+// Unexpected errors are logged, and the client only sees a generic message.
+func (app *application) bulkErrorStatus(r *http.Request, err error) (int, string) {
+	switch {
+	case errors.Is(err, data.ErrRecordNotFound):
+		return http.StatusNotFound, "the requested resource could not be found"
+	case errors.Is(err, data.ErrEditConflict):
+		return http.StatusConflict, "unable to update the record due to an edit conflict, please try again"
+	case errors.As(err, &bulkBadRequestError{}):
+		return http.StatusBadRequest, err.Error()
+	default:
+		app.logError(r, err)
+		return http.StatusInternalServerError, "the server encountered a problem and could not process your request"
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/markponce/greenlight/internal/data"
+	"github.com/markponce/greenlight/internal/validator"
+)
+
+const (
+	// exportFlushRows is how many movies are written between flushes.
+	exportFlushRows = 500
+	// exportWriteTimeout is how long each chunk of an export has to be written in.
+	// It matches the server's WriteTimeout, which is renewed after every flush so that
+	// only a stalled export is cut off, not a long one.
+	exportWriteTimeout = 10 * time.Second
+)
+
+// exportMoviesHandler streams every movie matching the title and genres filters as CSV
+// or NDJSON, depending on the format query string parameter. For example:
+//
+//	curl -o movies.csv 'localhost:4000/v1/movies/export?format=csv&genres=drama'
+//
+// The CSV output can be fed straight back into the import endpoint.
+func (app *application) exportMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	var criteria data.MovieCriteria
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	criteria.Title = app.readString(qs, "title", "")
+	criteria.Genres = app.readCSV(qs, "genres", []string{})
+	format := app.readString(qs, "format", "ndjson")
+
+	v.Check(validator.PermittedValue(format, "csv", "ndjson"), "format", "must be either csv or ndjson")
+
+	taxonomy, err := app.models.Genres.Taxonomy()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	criteria.Genres = data.CanonicalGenreFilter(v, "genres", criteria.Genres, taxonomy)
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	includeUnpublished, err := app.canSeeUnpublished(r)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	criteria.IncludeUnpublished = includeUnpublished
+
+	// write adds a movie to the response, while flush sends whatever has been buffered
+	// on to the client.
+	var write func(*data.Movie) error
+	flush := func() error { return nil }
+
+	switch format {
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="movies.csv"`)
+
+		// The csv.Writer buffers its output, so the header row doesn't reach the
+		// response until the first flush, leaving room for an error response if the
+		// query fails.
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"id", "created_at", "title", "year", "runtime", "genres", "version"})
+
+		write = func(movie *data.Movie) error {
+			cw.Write([]string{
+				strconv.FormatInt(movie.ID, 10),
+				movie.CreatedAt.Format(time.RFC3339),
+				movie.Title,
+				strconv.Itoa(int(movie.Year)),
+				strconv.Itoa(int(movie.Runtime)),
+				strings.Join(movie.Genres, "|"),
+				strconv.Itoa(int(movie.Vesion)),
+			})
+
+			return cw.Error()
+		}
+
+		flush = func() error {
+			cw.Flush()
+			return cw.Error()
+		}
+	default:
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Header().Set("Content-Disposition", `attachment; filename="movies.ndjson"`)
+
+		enc := json.NewEncoder(w)
+
+		write = func(movie *data.Movie) error {
+			return enc.Encode(movie)
+		}
+	}
+
+	rc := http.NewResponseController(w)
+	rows := 0
+
+	// Flush every exportFlushRows movies and push the write deadline back, so that the
+	// client receives the export as it's produced and the connection isn't closed
+	// partway through.
+	err = app.models.Movies.Export(r.Context(), criteria, func(movie *data.Movie) error {
+		err := write(movie)
+		if err != nil {
+			return err
+		}
+
+		rows++
+		if rows%exportFlushRows != 0 {
+			return nil
+		}
+
+		err = flush()
+		if err != nil {
+			return err
+		}
+
+		err = rc.SetWriteDeadline(time.Now().Add(exportWriteTimeout))
+		if err != nil {
+			return err
+		}
+
+		return rc.Flush()
+	})
+	if err != nil {
+		// Once the first movie has been written the status code can't be changed, so
+		// all that can be done is to log the error and cut the response short.
+		if rows == 0 {
+			app.serverErrorResponse(w, r, err)
+		} else {
+			app.logError(r, err)
+		}
+		return
+	}
+
+	err = flush()
+	if err != nil {
+		app.logError(r, err)
+	}
+}
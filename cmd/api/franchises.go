@@ -0,0 +1,360 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/markponce/greenlight/internal/data"
+	"github.com/markponce/greenlight/internal/validator"
+)
+
+// getFranchiseForRequest fetches the franchise identified by the :id URL parameter.
+// If anything goes wrong, the error response has already been sent and the returned
+// bool is false.
+func (app *application) getFranchiseForRequest(w http.ResponseWriter, r *http.Request) (*data.Franchise, bool) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	franchise, err := app.models.Franchises.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	return franchise, true
+}
+
+// writeFranchise sends a franchise along with its movies in release order and their
+// total runtime.
+func (app *application) writeFranchise(w http.ResponseWriter, r *http.Request, status int, franchise *data.Franchise) {
+	includeUnpublished, err := app.canSeeUnpublished(r)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	movies, err := app.models.Franchises.GetMovies(franchise.ID, includeUnpublished)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	localized := make([]*data.Movie, len(movies))
+	for i, item := range movies {
+		localized[i] = item.Movie
+	}
+
+	err = app.localizeMovies(w, r, localized...)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	env := envelop{
+		"franchise":     franchise,
+		"movies":        movies,
+		"total_runtime": data.TotalRuntime(movies),
+	}
+
+	err = app.writeJSON(w, status, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) createFranchiseHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	franchise := &data.Franchise{
+		Name:        input.Name,
+		Description: input.Description,
+	}
+
+	v := validator.New()
+
+	if data.ValidateFranchise(v, franchise); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Franchises.Insert(franchise)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateFranchise):
+			v.AddError("name", "a franchise with this name already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/franchises/%d", franchise.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelop{"franchise": franchise}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showFranchiseHandler(w http.ResponseWriter, r *http.Request) {
+	franchise, ok := app.getFranchiseForRequest(w, r)
+	if !ok {
+		return
+	}
+
+	app.writeFranchise(w, r, http.StatusOK, franchise)
+}
+
+func (app *application) updateFranchiseHandler(w http.ResponseWriter, r *http.Request) {
+	franchise, ok := app.getFranchiseForRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Name        *string `json:"name"`
+		Description *string `json:"description"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Name != nil {
+		franchise.Name = *input.Name
+	}
+
+	if input.Description != nil {
+		franchise.Description = *input.Description
+	}
+
+	v := validator.New()
+
+	if data.ValidateFranchise(v, franchise); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Franchises.Update(franchise)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		case errors.Is(err, data.ErrDuplicateFranchise):
+			v.AddError("name", "a franchise with this name already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelop{"franchise": franchise}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteFranchiseHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Franchises.Delete(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelop{"message": "franchise successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listFranchisesHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name string
+		data.Filters
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	input.Name = app.readString(qs, "name", "")
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "name")
+	input.Filters.SortSafelist = []string{"id", "name", "-id", "-name"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	franchises, metadata, err := app.models.Franchises.GetAll(input.Name, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelop{"franchises": franchises, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) addFranchiseMovieHandler(w http.ResponseWriter, r *http.Request) {
+	franchise, ok := app.getFranchiseForRequest(w, r)
+	if !ok {
+		return
+	}
+
+	// The position is the movie's place in the series, and the movie is added to the
+	// end of the series if it isn't given.
+	var input struct {
+		MovieID  int64 `json:"movie_id"`
+		Position int   `json:"position"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	v.Check(input.MovieID > 0, "movie_id", "must be provided")
+	v.Check(input.Position >= 0, "position", "must be a positive integer")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Franchises.AddMovie(franchise.ID, input.MovieID, input.Position)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("movie_id", "must refer to an existing movie")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrDuplicateFranchiseMovie):
+			v.AddError("movie_id", "is already in this franchise")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.writeFranchise(w, r, http.StatusCreated, franchise)
+}
+
+func (app *application) removeFranchiseMovieHandler(w http.ResponseWriter, r *http.Request) {
+	franchise, ok := app.getFranchiseForRequest(w, r)
+	if !ok {
+		return
+	}
+
+	movieID, err := app.readInt64Param(r, "movie_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Franchises.RemoveMovie(franchise.ID, movieID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelop{"message": "movie successfully removed from franchise"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) reorderFranchiseHandler(w http.ResponseWriter, r *http.Request) {
+	franchise, ok := app.getFranchiseForRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		MovieIDs []int64 `json:"movie_ids"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	v.Check(input.MovieIDs != nil, "movie_ids", "must be provided")
+	v.Check(validator.Unique(input.MovieIDs), "movie_ids", "must not contain duplicate values")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// The movies the user can't see aren't given, just like those in the trash.
+	includeUnpublished, err := app.canSeeUnpublished(r)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.models.Franchises.Reorder(franchise.ID, input.MovieIDs, includeUnpublished)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrInvalidFranchiseOrder):
+			v.AddError("movie_ids", "must contain every movie in the franchise exactly once")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.writeFranchise(w, r, http.StatusOK, franchise)
+}
@@ -11,15 +11,22 @@ import (
 	"strings"
 
 	"github.com/julienschmidt/httprouter"
+	"github.com/markponce/greenlight/internal/data"
 	"github.com/markponce/greenlight/internal/validator"
 )
 
 func (app *application) readIDParam(r *http.Request) (int64, error) {
+	return app.readInt64Param(r, "id")
+}
+
+// The readInt64Param() helper reads a named URL parameter and converts it to a positive
+// int64, for routes which take more than one ID.
+func (app *application) readInt64Param(r *http.Request, name string) (int64, error) {
 	params := httprouter.ParamsFromContext(r.Context())
 
-	id, err := strconv.ParseInt(params.ByName("id"), 10, 64)
+	id, err := strconv.ParseInt(params.ByName(name), 10, 64)
 	if err != nil || id < 1 {
-		return 0, errors.New("invalid id parameter")
+		return 0, fmt.Errorf("invalid %s parameter", name)
 	}
 
 	return id, nil
@@ -59,13 +66,27 @@ func (app *application) writeJSON(w http.ResponseWriter, status int, data envelo
 func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst any) error {
 	// Use http.MaxBytesReader() to limit the size of the request body to 1,048,576
 	// bytes (1MB).
-	r.Body = http.MaxBytesReader(w, r.Body, 1_048_576)
+	return app.readJSONWithLimit(w, r, dst, 1_048_576)
+}
+
+// The readJSONWithLimit() helper works like readJSON(), but with a custom limit on the
+// size of the request body for endpoints which accept larger payloads.
+func (app *application) readJSONWithLimit(w http.ResponseWriter, r *http.Request, dst any, maxBytes int64) error {
+	r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+
+	return app.decodeJSON(r.Body, dst)
+}
 
+// The decodeJSON() helper decodes a single JSON value from body into dst, translating
+// any decoding errors into plain-english messages which are suitable for sending back
+// to the client. It's used by readJSON(), and directly when the JSON doesn't come
+// straight from the request body (such as the result of applying a patch).
+func (app *application) decodeJSON(body io.Reader, dst any) error {
 	// Initialize the json.Decoder, and call the DisallowUnknownFields() method on it
 	// before decoding. This means that if the JSON from the client now includes any
 	// field which cannot be mapped to the target destination, the decoder will return
 	// an error instead of just ignoring the field.
-	dec := json.NewDecoder(r.Body)
+	dec := json.NewDecoder(body)
 	dec.DisallowUnknownFields()
 
 	// Decode the request body to the destination.
@@ -219,3 +240,81 @@ func (app *application) Background(fn func()) {
 		fn()
 	}()
 }
+
+// The readBool() helper reads a string value from the query string and converts it to
+// a bool before returning. If no matching key could be found it returns the provided
+// default value. If the value couldn't be converted to a bool, then we record an error
+// message in the provided Validator instance.
+func (app *application) readBool(qs url.Values, key string, defaultValue bool, v *validator.Validator) bool {
+	s := qs.Get(key)
+
+	if s == "" {
+		return defaultValue
+	}
+
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		v.AddError(key, "must be a boolean value")
+		return defaultValue
+	}
+
+	return b
+}
+
+// The movieETag() helper returns the entity tag for the current state of a movie.
+// Because the version number is incremented on every change, the ID and version
+// together are enough to identify it. A localized movie's body differs from one
+// locale to the next, so its locale is added to the tag too.
+func movieETag(movie *data.Movie) string {
+	if movie.Locale != "" {
+		return fmt.Sprintf(`"%d-%d-%s"`, movie.ID, movie.Vesion, movie.Locale)
+	}
+
+	return fmt.Sprintf(`"%d-%d"`, movie.ID, movie.Vesion)
+}
+
+// The movieVersionMatches() helper reports whether an If-Match header value matches
+// the current version of a movie. Writes don't depend on the locale the client read
+// the movie in, so the tag of any localized copy of the current version matches as
+// well as the plain one.
+func movieVersionMatches(header string, movie *data.Movie) bool {
+	if etagMatches(header, movieETag(movie), false) {
+		return true
+	}
+
+	prefix := fmt.Sprintf(`"%d-%d-`, movie.ID, movie.Vesion)
+
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+
+		if strings.HasPrefix(tag, prefix) && strings.HasSuffix(tag, `"`) && len(tag) > len(prefix)+1 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// The etagMatches() helper reports whether an If-Match or If-None-Match header value
+// matches the given entity tag. The header may contain a comma-separated list of tags
+// or "*", which matches anything. If-None-Match uses the weak comparison, so weak is
+// set to ignore any W/ prefixes; otherwise weak tags never match.
+func etagMatches(header, etag string, weak bool) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+
+		if tag == "*" {
+			return true
+		}
+
+		if weak {
+			tag = strings.TrimPrefix(tag, "W/")
+		}
+
+		if tag == etag {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"time"
+
+	"github.com/markponce/greenlight/internal/data"
+	"github.com/markponce/greenlight/internal/imaging"
+	"github.com/markponce/greenlight/internal/validator"
+)
+
+const (
+	// imageMaxBytes is the largest image file accepted.
+	imageMaxBytes = 10 * 1_048_576
+	// imageTimeout is how long an image upload is allowed to take, including making
+	// the thumbnails.
+	imageTimeout = 2 * time.Minute
+)
+
+// imageExtensions maps the accepted image content types to the extensions their
+// files are stored with.
+var imageExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+}
+
+// uploadMovieImageHandler attaches a poster or still to a movie. The image is sent
+// as multipart/form-data in the image field, with the kind field set to poster (the
+// default) or still. For example:
+//
+//	curl -F image=@poster.jpg -F kind=poster localhost:4000/v1/movies/1/images
+func (app *application) uploadMovieImageHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	movie, err := app.models.Movies.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Uploads can take longer than the server's usual timeouts allow for.
+	rc := http.NewResponseController(w)
+	deadline := time.Now().Add(imageTimeout)
+
+	err = rc.SetReadDeadline(deadline)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = rc.SetWriteDeadline(deadline)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Leave some room over imageMaxBytes for the rest of the multipart body. Parts
+	// larger than 1MB are spooled to temporary files rather than held in memory.
+	r.Body = http.MaxBytesReader(w, r.Body, imageMaxBytes+1_048_576)
+
+	err = r.ParseMultipartForm(1_048_576)
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+
+		switch {
+		case errors.As(err, &maxBytesError):
+			app.badRequestResponse(w, r, fmt.Errorf("image must not be larger than %d bytes", imageMaxBytes))
+		default:
+			app.badRequestResponse(w, r, fmt.Errorf("body must be multipart/form-data: %w", err))
+		}
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	img := &data.MovieImage{
+		MovieID: movie.ID,
+		Kind:    r.FormValue("kind"),
+	}
+	if img.Kind == "" {
+		img.Kind = data.ImagePoster
+	}
+
+	v := validator.New()
+
+	file, header, err := r.FormFile("image")
+	if err != nil {
+		v.AddError("image", "must be provided")
+	} else {
+		defer file.Close()
+
+		v.Check(header.Size <= imageMaxBytes, "image", "must not be larger than 10MB")
+		img.Size = header.Size
+	}
+
+	if data.ValidateMovieImage(v, img); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Work out the type from the file's contents, rather than trusting the
+	// Content-Type sent by the client.
+	img.ContentType, err = sniffContentType(file)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	ext, ok := imageExtensions[img.ContentType]
+	if !ok {
+		v.AddError("image", "must be a JPEG, PNG or GIF image")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	decoded, err := imaging.Decode(file)
+	if err != nil {
+		switch {
+		case errors.Is(err, imaging.ErrTooLarge):
+			v.AddError("image", fmt.Sprintf("must not be more than %d pixels wide or high", imaging.MaxDimension))
+		default:
+			v.AddError("image", "must be a valid image")
+		}
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	img.Width, img.Height = decoded.Bounds().Dx(), decoded.Bounds().Dy()
+
+	name, err := randomName()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	img.Key = fmt.Sprintf("movies/%d/%s%s", movie.ID, name, ext)
+
+	err = app.storeImage(r, img, file, decoded)
+	if err != nil {
+		app.deleteImageFiles(r, img)
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.models.Images.Insert(img, app.contextGetUser(r).ID)
+	if err != nil {
+		app.deleteImageFiles(r, img)
+
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.setImageURLs(img)
+
+	headers := make(http.Header)
+	headers.Set("Location", img.URL)
+
+	err = app.writeJSON(w, http.StatusCreated, envelop{"image": img}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteMovieImageHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	imageID, err := app.readInt64Param(r, "image_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	img, err := app.models.Images.Delete(id, imageID, app.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.deleteImageFiles(r, img)
+
+	err = app.writeJSON(w, http.StatusOK, envelop{"message": "image successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// sniffContentType detects the type of an uploaded file from its first 512 bytes,
+// leaving the file positioned back at the start.
+func sniffContentType(file multipart.File) (string, error) {
+	buf := make([]byte, 512)
+
+	n, err := io.ReadFull(file, buf)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+
+	_, err = file.Seek(0, io.SeekStart)
+	if err != nil {
+		return "", err
+	}
+
+	return http.DetectContentType(buf[:n]), nil
+}
+
+// randomName returns a random file name, so that image URLs can't be guessed and
+// never clash.
+func randomName() (string, error) {
+	b := make([]byte, 16)
+
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// storeImage saves the original image file and a JPEG thumbnail in each of the sizes
+// in data.ThumbnailWidths.
+func (app *application) storeImage(r *http.Request, img *data.MovieImage, file multipart.File, decoded image.Image) error {
+	_, err := file.Seek(0, io.SeekStart)
+	if err != nil {
+		return err
+	}
+
+	err = app.images.Put(r.Context(), img.Key, file, img.ContentType)
+	if err != nil {
+		return err
+	}
+
+	// The image is converted once and shared by all the thumbnails, since the
+	// conversion costs as much as making a thumbnail does.
+	rgba := imaging.RGBA(decoded)
+
+	for size, width := range data.ThumbnailWidths {
+		var buf bytes.Buffer
+
+		err = imaging.EncodeJPEG(&buf, imaging.Thumbnail(rgba, width))
+		if err != nil {
+			return err
+		}
+
+		err = app.images.Put(r.Context(), img.ThumbnailKey(size), &buf, "image/jpeg")
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// deleteImageFiles removes an image and its thumbnails from storage. Failures are
+// only logged, since by this point the image is already gone as far as clients can
+// tell.
+func (app *application) deleteImageFiles(r *http.Request, img *data.MovieImage) {
+	for _, key := range img.Keys() {
+		err := app.images.Delete(r.Context(), key)
+		if err != nil {
+			app.logError(r, err)
+		}
+	}
+}
+
+// setImageURLs fills in the URLs of an image and its thumbnails.
+func (app *application) setImageURLs(img *data.MovieImage) {
+	img.URL = app.images.URL(img.Key)
+	img.Thumbnails = make(map[string]string, len(data.ThumbnailWidths))
+
+	for size := range data.ThumbnailWidths {
+		img.Thumbnails[size] = app.images.URL(img.ThumbnailKey(size))
+	}
+}
+
+// attachImages loads the images of each of the movies, with their URLs filled in.
+func (app *application) attachImages(movies ...*data.Movie) error {
+	if len(movies) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, len(movies))
+	for i, movie := range movies {
+		ids[i] = movie.ID
+	}
+
+	images, err := app.models.Images.GetForMovies(ids)
+	if err != nil {
+		return err
+	}
+
+	for _, movie := range movies {
+		movie.Images = images[movie.ID]
+
+		for _, img := range movie.Images {
+			app.setImageURLs(img)
+		}
+	}
+
+	return nil
+}
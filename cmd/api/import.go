@@ -0,0 +1,124 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"time"
+
+	"github.com/markponce/greenlight/internal/importer"
+	"github.com/markponce/greenlight/internal/validator"
+)
+
+const (
+	// importMaxBytes is the size limit for import request bodies.
+	importMaxBytes = 100 * 1_048_576
+	// importTimeout is how long an import request is allowed to take, which is much
+	// longer than the server's usual read and write timeouts.
+	importTimeout = 10 * time.Minute
+)
+
+// importMoviesHandler reads a CSV or NDJSON file of movies from the request body and
+// inserts them in batches. The format is taken from the format query string
+// parameter, or else the Content-Type header. For example:
+//
+//	curl -X POST -H 'Content-Type: text/csv' --data-binary @movies.csv \
+//		'localhost:4000/v1/movies/import?dry_run=true&columns=title=Name,year=Released'
+func (app *application) importMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	qs := r.URL.Query()
+
+	opts := importer.Options{
+		Format:    app.readString(qs, "format", ""),
+		DryRun:    app.readBool(qs, "dry_run", false, v),
+		Upsert:    app.readBool(qs, "upsert", false, v),
+		BatchSize: app.readInt(qs, "batch_size", 500, v),
+		UserID:    app.contextGetUser(r).ID,
+	}
+
+	if opts.Format == "" {
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+		switch mediaType {
+		case "text/csv":
+			opts.Format = importer.FormatCSV
+		case "application/x-ndjson", "application/ndjson":
+			opts.Format = importer.FormatNDJSON
+		}
+	}
+
+	columns, err := importer.ParseColumns(app.readString(qs, "columns", ""))
+	if err != nil {
+		v.AddError("columns", "must be a comma-separated list of field=column pairs")
+	}
+	opts.Columns = columns
+
+	if importer.ValidateOptions(v, opts); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	opts.Taxonomy, err = app.models.Genres.Taxonomy()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Large files take longer to upload and insert than the server's timeouts allow
+	// for, so extend the deadlines for this request only.
+	rc := http.NewResponseController(w)
+	deadline := time.Now().Add(importTimeout)
+
+	err = rc.SetReadDeadline(deadline)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = rc.SetWriteDeadline(deadline)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, importMaxBytes)
+
+	// Batches are committed as they go, so if the import fails partway through, the
+	// error response carries the report too, saying how much was written.
+	report, err := importer.Run(r.Body, &app.models.Movies, opts)
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+
+		switch {
+		case errors.As(err, &maxBytesError):
+			app.importFailedResponse(w, r, http.StatusBadRequest, fmt.Sprintf("body must not be larger than %d bytes", maxBytesError.Limit), report)
+		case errors.Is(err, importer.ErrInvalidInput):
+			app.importFailedResponse(w, r, http.StatusBadRequest, err.Error(), report)
+		default:
+			app.logError(r, err)
+			app.importFailedResponse(w, r, http.StatusInternalServerError, "the server encountered a problem and could not finish the import", report)
+		}
+		return
+	}
+
+	status := http.StatusOK
+	if !opts.DryRun && report.Inserted > 0 {
+		status = http.StatusCreated
+	}
+
+	err = app.writeJSON(w, status, envelop{"report": report}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// importFailedResponse sends an error response for an import which failed partway
+// through, along with the report of what had been imported by then.
+func (app *application) importFailedResponse(w http.ResponseWriter, r *http.Request, status int, message string, report *importer.Report) {
+	err := app.writeJSON(w, status, envelop{"error": message, "report": report}, nil)
+	if err != nil {
+		app.logError(r, err)
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
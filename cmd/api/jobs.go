@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// wait pauses one of the jobs below for the given duration. The jobs are started
+// with app.Background(), so serve() waits for them on shutdown; wait returns false
+// straight away once shutdown begins, and the job should then return.
+func (app *application) wait(d time.Duration) bool {
+	select {
+	case <-app.shutdown:
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
+
+// purgeDeletedMovies runs until the application shuts down, periodically removing
+// the movies which have been in the trash for longer than the configured retention
+// period, along with their image files.
+func (app *application) purgeDeletedMovies() {
+	for {
+		purged, images, err := app.models.Movies.PurgeDeleted(app.config.trash.retention)
+		if err != nil {
+			app.logger.Error(err.Error())
+		} else if purged > 0 {
+			app.logger.Info("purged deleted movies", "count", purged)
+		}
+
+		// Files which can't be removed are only logged, as the images are already
+		// gone from the database by now.
+		for _, img := range images {
+			for _, key := range img.Keys() {
+				err := app.images.Delete(context.Background(), key)
+				if err != nil {
+					app.logger.Error(err.Error(), "key", key)
+				}
+			}
+		}
+
+		if !app.wait(app.config.trash.purgeInterval) {
+			return
+		}
+	}
+}
+
+// recomputeSimilarities runs until the application shuts down, working through the
+// movies which have been queued to have their similarities recomputed. It keeps going
+// while there's a backlog, and otherwise checks the queue every configured interval.
+func (app *application) recomputeSimilarities() {
+	for {
+		recomputed, err := app.models.Similarities.RecomputeQueued(app.config.similarities.batchSize)
+		if err != nil {
+			app.logger.Error(err.Error())
+		} else if recomputed > 0 {
+			app.logger.Info("recomputed movie similarities", "count", recomputed)
+		}
+
+		var delay time.Duration
+		if err != nil || recomputed == 0 || recomputed < app.config.similarities.batchSize {
+			delay = app.config.similarities.interval
+		}
+
+		if !app.wait(delay) {
+			return
+		}
+	}
+}
+
+// publishScheduledMovies runs until the application shuts down, publishing the
+// scheduled movies which have reached their publish_at time. Movies are published
+// within the configured interval of being due.
+func (app *application) publishScheduledMovies() {
+	for {
+		published, err := app.models.Movies.PublishScheduled()
+		if err != nil {
+			app.logger.Error(err.Error())
+		} else if published > 0 {
+			app.logger.Info("published scheduled movies", "count", published)
+		}
+
+		if !app.wait(app.config.publishing.interval) {
+			return
+		}
+	}
+}
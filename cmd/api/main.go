@@ -16,6 +16,7 @@ import (
 	_ "github.com/lib/pq"
 	"github.com/markponce/greenlight/internal/data"
 	"github.com/markponce/greenlight/internal/mailer"
+	"github.com/markponce/greenlight/internal/storage"
 	"github.com/markponce/greenlight/internal/vcs"
 )
 
@@ -30,9 +31,11 @@ type config struct {
 		maxIdleTime  time.Duration
 	}
 	limiter struct {
-		rps     float64
-		burst   int
-		enabled bool
+		rps          float64
+		burst        int
+		suggestRPS   float64
+		suggestBurst int
+		enabled      bool
 	}
 	smtp struct {
 		host     string
@@ -45,6 +48,25 @@ type config struct {
 	cors struct {
 		trustedOrigins []string
 	}
+
+	trash struct {
+		retention     time.Duration
+		purgeInterval time.Duration
+	}
+
+	images struct {
+		dir     string
+		baseURL string
+	}
+
+	similarities struct {
+		interval  time.Duration
+		batchSize int
+	}
+
+	publishing struct {
+		interval time.Duration
+	}
 }
 
 // Define an application struct to hold the dependencies for our HTTP handlers, helpers,
@@ -55,6 +77,14 @@ type application struct {
 	models data.Models
 	mailer *mailer.Mailer
 	wg     sync.WaitGroup
+	// shutdown is closed when the server starts shutting down, to tell the
+	// background jobs to stop.
+	shutdown chan struct{}
+
+	// suggestions caches the results of the title suggestions endpoint.
+	suggestions *suggestionCache
+	// images is where uploaded movie images are kept.
+	images storage.Storage
 }
 
 var (
@@ -76,6 +106,8 @@ func main() {
 
 	flag.Float64Var(&cfg.limiter.rps, "limiter-rps", 2, "Rate limiter maximum requests per second")
 	flag.IntVar(&cfg.limiter.burst, "limiter-burst", 4, "Rate limiter maximum burst")
+	flag.Float64Var(&cfg.limiter.suggestRPS, "limiter-suggest-rps", 10, "Rate limiter maximum title suggestion requests per second")
+	flag.IntVar(&cfg.limiter.suggestBurst, "limiter-suggest-burst", 20, "Rate limiter maximum title suggestion burst")
 	flag.BoolVar(&cfg.limiter.enabled, "limiter-enabled", true, "Enable rate limiter")
 
 	// smtp settings
@@ -90,6 +122,20 @@ func main() {
 		return nil
 	})
 
+	flag.DurationVar(&cfg.trash.retention, "trash-retention", 30*24*time.Hour, "How long deleted movies are kept before being purged")
+	flag.DurationVar(&cfg.trash.purgeInterval, "trash-purge-interval", time.Hour, "How often to purge deleted movies")
+
+	// Uploaded images are kept on the local filesystem and served by the API under
+	// /images, unless the base URL is changed to point somewhere else that serves the
+	// same directory.
+	flag.StringVar(&cfg.images.dir, "images-dir", "./uploads", "Directory to store uploaded images in")
+	flag.StringVar(&cfg.images.baseURL, "images-base-url", "/images", "Base URL that uploaded images are served from")
+
+	flag.DurationVar(&cfg.similarities.interval, "similarities-interval", time.Minute, "How often to check for movies whose similarities need recomputing")
+	flag.IntVar(&cfg.similarities.batchSize, "similarities-batch-size", 100, "Maximum number of movies to recompute similarities for at a time")
+
+	flag.DurationVar(&cfg.publishing.interval, "publish-interval", 30*time.Second, "How often to publish scheduled movies which are due")
+
 	displayVersion := flag.Bool("version", false, "Display version and exit")
 
 	flag.Parse()
@@ -148,13 +194,27 @@ func main() {
 		return time.Now().Unix()
 	}))
 
+	images, err := storage.NewLocal(cfg.images.dir, cfg.images.baseURL)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+
 	app := application{
 		config: cfg,
 		logger: logger,
 		models: data.NewModel(db),
 		mailer: mailer,
+
+		shutdown:    make(chan struct{}),
+		suggestions: newSuggestionCache(suggestionCacheTTL, suggestionCacheSize),
+		images:      images,
 	}
 
+	app.Background(app.purgeDeletedMovies)
+	app.Background(app.recomputeSimilarities)
+	app.Background(app.publishScheduledMovies)
+
 	err = app.serve()
 	if err != nil {
 		logger.Error(err.Error())
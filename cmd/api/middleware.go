@@ -42,6 +42,32 @@ func (app *application) recoverPanic(next http.Handler) http.Handler {
 }
 
 func (app *application) rateLimit(next http.Handler) http.Handler {
+	limited := app.limitByIP(app.config.limiter.rps, app.config.limiter.burst, next)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Suggestions are requested on every keystroke, so they have a limiter of
+		// their own (see rateLimitSuggestions) rather than using up the main one.
+		// That limiter is only on the GET route, so other methods still go through
+		// this one.
+		if r.Method == http.MethodGet && r.URL.Path == "/v1/movies/suggest" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		limited.ServeHTTP(w, r)
+	})
+}
+
+// rateLimitSuggestions applies the separate, more generous rate limit used for the
+// title suggestions endpoint.
+func (app *application) rateLimitSuggestions(next http.HandlerFunc) http.HandlerFunc {
+	return app.limitByIP(app.config.limiter.suggestRPS, app.config.limiter.suggestBurst, next).ServeHTTP
+}
+
+// limitByIP limits each client IP address to rps requests per second, with bursts of
+// up to burst requests. Each call keeps its own set of clients, so limits applied by
+// different calls don't affect each other.
+func (app *application) limitByIP(rps float64, burst int, next http.Handler) http.Handler {
 
 	type client struct {
 		limiter  *rate.Limiter
@@ -79,7 +105,7 @@ func (app *application) rateLimit(next http.Handler) http.Handler {
 			if _, found := clients[ip]; !found {
 				// Create and add a new client struct to the map if it doesn't already exist.
 				clients[ip] = &client{
-					limiter: rate.NewLimiter(rate.Limit(app.config.limiter.rps), app.config.limiter.burst)}
+					limiter: rate.NewLimiter(rate.Limit(rps), burst)}
 			}
 
 			// Update the last seen time for the client.
@@ -243,6 +269,10 @@ func (app *application) enableCORS(next http.Handler) http.Handler {
 				if origin == app.config.cors.trustedOrigins[i] {
 					w.Header().Set("Access-Control-Allow-Origin", origin)
 
+					// Let browser clients read the ETag header, so that they can send
+					// it back in If-Match and If-None-Match headers.
+					w.Header().Set("Access-Control-Expose-Headers", "ETag")
+
 					// Check if the request has the HTTP method OPTIONS and contains the
 					// "Access-Control-Request-Method" header. If it does, then we treat
 					// it as a preflight request.
@@ -250,7 +280,7 @@ func (app *application) enableCORS(next http.Handler) http.Handler {
 						// Set the necessary preflight response headers, as discussed
 						// previously.
 						w.Header().Set("Access-Control-Allow-Methods", "OPTIONS, PUT, PATCH, DELETE")
-						w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+						w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, If-Match, If-None-Match")
 
 						// Write the headers along with a 200 OK status and return from
 						// the middleware with no further action.
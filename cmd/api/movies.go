@@ -1,11 +1,18 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"mime"
 	"net/http"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/markponce/greenlight/internal/data"
+	"github.com/markponce/greenlight/internal/jsonpatch"
 	"github.com/markponce/greenlight/internal/validator"
 )
 
@@ -14,12 +21,7 @@ func (app *application) createMovieHandler(w http.ResponseWriter, r *http.Reques
 	// Sample of correct post curt
 	// curl -i -d '{"title":"Moana","year":2016,"runtime":107, "genres":["animation","adventure"]}' localhost:4000/v1/movies
 
-	var input struct {
-		Title   string       `json:"title"`
-		Year    int32        `json:"year"`
-		Runtime data.Runtime `json:"runtime"`
-		Genres  []string     `json:"genres"`
-	}
+	var input movieInput
 
 	err := app.readJSON(w, r, &input)
 	if err != nil {
@@ -28,20 +30,28 @@ func (app *application) createMovieHandler(w http.ResponseWriter, r *http.Reques
 	}
 
 	movie := &data.Movie{
-		Title:   input.Title,
-		Year:    input.Year,
-		Runtime: input.Runtime,
-		Genres:  input.Genres,
+		Title:     input.Title,
+		Year:      input.Year,
+		Runtime:   input.Runtime,
+		Genres:    input.Genres,
+		Status:    input.Status,
+		PublishAt: input.PublishAt,
+	}
+
+	taxonomy, err := app.models.Genres.Taxonomy()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
 	}
 
 	v := validator.New()
 
-	if data.ValidateMovie(v, movie); !v.Valid() {
+	if data.ValidateMovie(v, movie, taxonomy); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	err = app.models.Movies.Insert(movie)
+	err = app.models.Movies.Insert(movie, app.contextGetUser(r).ID)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
@@ -64,15 +74,32 @@ func (app *application) showMovieHandler(w http.ResponseWriter, r *http.Request)
 		app.notFoundResponse(w, r)
 		return
 	}
-	var movie *data.Movie
-	movie, err = app.models.Movies.Get(id)
+	movie, ok := app.getVisibleMovie(w, r, id)
+	if !ok {
+		return
+	}
+
+	// The localized title is worked out first so that a 304 response carries the
+	// same Vary header as the full one would.
+	err = app.localizeMovies(w, r, movie)
 	if err != nil {
-		switch {
-		case errors.Is(err, data.ErrRecordNotFound):
-			app.notFoundResponse(w, r)
-		default:
-			app.serverErrorResponse(w, r, err)
-		}
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Clients which already have the current version of the movie can reuse their
+	// cached copy, so there's no need to send it again.
+	etag := movieETag(movie)
+
+	if match := r.Header.Get("If-None-Match"); match != "" && etagMatches(match, etag, true) {
+		w.Header().Set("ETag", etag)
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	err = app.attachImages(movie)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
 		return
 	}
 
@@ -80,22 +107,45 @@ func (app *application) showMovieHandler(w http.ResponseWriter, r *http.Request)
 		"movie": movie,
 	}
 
-	err = app.writeJSON(w, http.StatusOK, data, nil)
+	headers := make(http.Header)
+	headers.Set("ETag", etag)
+
+	err = app.writeJSON(w, http.StatusOK, data, headers)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
 
-func (app *application) updateMovieHandler(w http.ResponseWriter, r *http.Request) {
-	id, err := app.readIDParam(r)
+// movieInput is the JSON representation of the fields of a movie which clients can
+// set, as sent when creating or replacing a movie. Patches are applied to the same
+// representation. Leaving out the status keeps the movie's current one, or publishes
+// a new movie straight away.
+type movieInput struct {
+	Title     string       `json:"title"`
+	Year      int32        `json:"year"`
+	Runtime   data.Runtime `json:"runtime"`
+	Genres    []string     `json:"genres"`
+	Status    string       `json:"status,omitempty"`
+	PublishAt *time.Time   `json:"publish_at,omitempty"`
+}
+
+// canSeeUnpublished reports whether the user making the request can see movies which
+// haven't been published, which is the case for anyone who can edit movies.
+func (app *application) canSeeUnpublished(r *http.Request) (bool, error) {
+	permissions, err := app.models.Permissions.GetAllForUser(app.contextGetUser(r).ID)
 	if err != nil {
-		app.notFoundResponse(w, r)
-		return
+		return false, err
 	}
 
-	// retrieve the movie record
-	var movie *data.Movie
-	movie, err = app.models.Movies.Get(id)
+	return permissions.Include("movies:write"), nil
+}
+
+// getVisibleMovie fetches a movie for a request which reads it or something that
+// belongs to it. Unpublished movies are treated as missing for users who can't see
+// them. If anything goes wrong, the error response has already been sent and the
+// returned bool is false.
+func (app *application) getVisibleMovie(w http.ResponseWriter, r *http.Request, id int64) (*data.Movie, bool) {
+	movie, err := app.models.Movies.Get(id)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -103,46 +153,75 @@ func (app *application) updateMovieHandler(w http.ResponseWriter, r *http.Reques
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
-		return
+		return nil, false
 	}
 
-	var input struct {
-		Title   *string       `json:"title"`
-		Year    *int32        `json:"year"`
-		Runtime *data.Runtime `json:"runtime"`
-		Genres  []string      `json:"genres"`
+	if movie.Status != data.StatusPublished {
+		visible, err := app.canSeeUnpublished(r)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return nil, false
+		}
+
+		if !visible {
+			app.notFoundResponse(w, r)
+			return nil, false
+		}
 	}
 
-	err = app.readJSON(w, r, &input)
+	return movie, true
+}
+
+// getMovieForUpdate fetches the movie identified by the :id URL parameter, checking
+// it against any If-Match header the client sent so that they only change the
+// version of the movie they think they are changing. If anything goes wrong, the
+// error response has already been sent and the returned bool is false.
+func (app *application) getMovieForUpdate(w http.ResponseWriter, r *http.Request) (*data.Movie, bool) {
+	id, err := app.readIDParam(r)
 	if err != nil {
-		app.badRequestResponse(w, r, err)
-		return
+		app.notFoundResponse(w, r)
+		return nil, false
 	}
 
-	if input.Title != nil {
-		movie.Title = *input.Title
+	// retrieve the movie record
+	movie, err := app.models.Movies.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
 	}
 
-	if input.Year != nil {
-		movie.Year = *input.Year
+	// If the client sent an If-Match header, make sure they are updating the version
+	// of the movie they think they are before reading the request body.
+	if match := r.Header.Get("If-Match"); match != "" && !movieVersionMatches(match, movie) {
+		app.preconditionFailedResponse(w, r)
+		return nil, false
 	}
 
-	if input.Runtime != nil {
-		movie.Runtime = *input.Runtime
-	}
+	return movie, true
+}
 
-	if input.Genres != nil {
-		movie.Genres = input.Genres
+// saveMovie validates the changes made to a movie and saves them, then sends the
+// updated movie to the client with the given status code.
+func (app *application) saveMovie(w http.ResponseWriter, r *http.Request, movie *data.Movie, status int) {
+	taxonomy, err := app.models.Genres.Taxonomy()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
 	}
 
 	v := validator.New()
 
-	if data.ValidateMovie(v, movie); !v.Valid() {
+	if data.ValidateMovie(v, movie, taxonomy); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	err = app.models.Movies.Update(movie)
+	err = app.models.Movies.Update(movie, app.contextGetUser(r).ID)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrEditConflict):
@@ -153,12 +232,165 @@ func (app *application) updateMovieHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusCreated, envelop{"movie": movie}, nil)
+	headers := make(http.Header)
+	headers.Set("ETag", movieETag(movie))
+
+	err = app.writeJSON(w, status, envelop{"movie": movie}, headers)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
 
+func (app *application) updateMovieHandler(w http.ResponseWriter, r *http.Request) {
+	movie, ok := app.getMovieForUpdate(w, r)
+	if !ok {
+		return
+	}
+
+	// Plain JSON bodies only update the fields they contain. The JSON Merge Patch and
+	// JSON Patch formats are applied to the movie's JSON representation instead,
+	// which lets clients do things like add or remove a single genre.
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	switch mediaType {
+	case "", "application/json":
+		var input struct {
+			Title     *string       `json:"title"`
+			Year      *int32        `json:"year"`
+			Runtime   *data.Runtime `json:"runtime"`
+			Genres    []string      `json:"genres"`
+			Status    *string       `json:"status"`
+			PublishAt *time.Time    `json:"publish_at"`
+		}
+
+		err := app.readJSON(w, r, &input)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+
+		if input.Title != nil {
+			movie.Title = *input.Title
+		}
+
+		if input.Year != nil {
+			movie.Year = *input.Year
+		}
+
+		if input.Runtime != nil {
+			movie.Runtime = *input.Runtime
+		}
+
+		if input.Genres != nil {
+			movie.Genres = input.Genres
+		}
+
+		if input.Status != nil {
+			movie.Status = *input.Status
+		}
+
+		if input.PublishAt != nil {
+			movie.PublishAt = input.PublishAt
+		}
+
+	case "application/merge-patch+json", "application/json-patch+json":
+		err := app.patchMovie(w, r, movie, mediaType)
+		if err != nil {
+			switch {
+			case errors.Is(err, jsonpatch.ErrTestFailed):
+				app.patchTestFailedResponse(w, r, err)
+			default:
+				app.badRequestResponse(w, r, err)
+			}
+			return
+		}
+
+	default:
+		app.unsupportedMediaTypeResponse(w, r)
+		return
+	}
+
+	app.saveMovie(w, r, movie, http.StatusCreated)
+}
+
+// patchMovie applies the JSON Merge Patch or JSON Patch in the request body to the
+// movie. The result is decoded in the same way as a request body, so it must still
+// be a valid movie representation without any unknown fields.
+func (app *application) patchMovie(w http.ResponseWriter, r *http.Request, movie *data.Movie, mediaType string) error {
+	var patch json.RawMessage
+
+	err := app.readJSON(w, r, &patch)
+	if err != nil {
+		return err
+	}
+
+	doc, err := json.Marshal(movieInput{
+		Title:     movie.Title,
+		Year:      movie.Year,
+		Runtime:   movie.Runtime,
+		Genres:    movie.Genres,
+		Status:    movie.Status,
+		PublishAt: movie.PublishAt,
+	})
+	if err != nil {
+		return err
+	}
+
+	var patched []byte
+
+	switch mediaType {
+	case "application/merge-patch+json":
+		patched, err = jsonpatch.MergePatch(doc, patch)
+	default:
+		patched, err = jsonpatch.Apply(doc, patch)
+	}
+	if err != nil {
+		return err
+	}
+
+	var input movieInput
+
+	err = app.decodeJSON(bytes.NewReader(patched), &input)
+	if err != nil {
+		return err
+	}
+
+	movie.Title = input.Title
+	movie.Year = input.Year
+	movie.Runtime = input.Runtime
+	movie.Genres = input.Genres
+	movie.Status = input.Status
+	movie.PublishAt = input.PublishAt
+
+	return nil
+}
+
+// replaceMovieHandler replaces every field of a movie, so unlike a PATCH request the
+// body must contain a complete movie.
+func (app *application) replaceMovieHandler(w http.ResponseWriter, r *http.Request) {
+	movie, ok := app.getMovieForUpdate(w, r)
+	if !ok {
+		return
+	}
+
+	var input movieInput
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	movie.Title = input.Title
+	movie.Year = input.Year
+	movie.Runtime = input.Runtime
+	movie.Genres = input.Genres
+	movie.Status = input.Status
+	movie.PublishAt = input.PublishAt
+
+	app.saveMovie(w, r, movie, http.StatusOK)
+}
+
 func (app *application) deleteMovieHandler(w http.ResponseWriter, r *http.Request) {
 	// Extract the movie ID from the URL.
 	id, err := app.readIDParam(r)
@@ -167,13 +399,39 @@ func (app *application) deleteMovieHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	// If the client sent an If-Match header, only delete the movie if it's still at
+	// the version they expect. A version of 0 deletes it unconditionally.
+	var version int32
+
+	if match := r.Header.Get("If-Match"); match != "" {
+		movie, err := app.models.Movies.Get(id)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.notFoundResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		if !movieVersionMatches(match, movie) {
+			app.preconditionFailedResponse(w, r)
+			return
+		}
+
+		version = movie.Vesion
+	}
+
 	// Delete the movie from the database, sending a 404 Not Found response to the
 	// client if there isn't a matching record.
-	err = app.models.Movies.Delete(id)
+	err = app.models.Movies.Delete(id, version, app.contextGetUser(r).ID)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
 			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrEditConflict):
+			app.preconditionFailedResponse(w, r)
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
@@ -191,10 +449,9 @@ func (app *application) listMoviesHandler(w http.ResponseWriter, r *http.Request
 	// To keep things consistent with our other handlers, we'll define an input struct
 	// to hold the expected values from the request query string
 	var input struct {
-		Title  string
-		Genres []string
-
+		data.MovieCriteria
 		data.Filters
+		Facets []string
 	}
 
 	// Initialize a new Validator instance.
@@ -209,6 +466,46 @@ func (app *application) listMoviesHandler(w http.ResponseWriter, r *http.Request
 	input.Title = app.readString(qs, "title", "")
 	input.Genres = app.readCSV(qs, "genres", []string{})
 
+	// The title search tolerates typos, while title_prefix matches the start of each
+	// word for autocompletion. With highlight=true, each movie comes back with the
+	// matching words marked up.
+	input.TitlePrefix = app.readString(qs, "title_prefix", "")
+	input.Highlight = app.readBool(qs, "highlight", false, v)
+
+	// Optionally narrow the list down to the movies a person is credited on, or to
+	// the movies directed by someone matching the given name.
+	input.PersonID = int64(app.readInt(qs, "person_id", 0, v))
+	input.Director = app.readString(qs, "director", "")
+
+	// Or to the movies in a franchise.
+	input.FranchiseID = int64(app.readInt(qs, "franchise", 0, v))
+
+	// Or to the movies released in a country, optionally between two dates and with
+	// a certification there no more restrictive than max_certification.
+	input.Country = strings.ToUpper(app.readString(qs, "country", ""))
+	input.ReleasedFrom = app.readString(qs, "released_from", "")
+	input.ReleasedTo = app.readString(qs, "released_to", "")
+	input.MaxCertification = app.readString(qs, "max_certification", "")
+
+	// Or to the movies with a status. Movies which haven't been published are only
+	// ever listed for users who can edit movies.
+	input.Status = app.readString(qs, "status", "")
+
+	// By default a movie must have all of the genres given, but genres_mode=any
+	// relaxes that to at least one of them. Movies with any of the exclude_genres are
+	// left out either way.
+	input.GenresMode = app.readString(qs, "genres_mode", "all")
+	input.ExcludeGenres = app.readCSV(qs, "exclude_genres", []string{})
+
+	// Ranges are inclusive, and either end can be left open.
+	input.YearMin = int32(app.readInt(qs, "year_min", 0, v))
+	input.YearMax = int32(app.readInt(qs, "year_max", 0, v))
+	input.RuntimeMin = int32(app.readInt(qs, "runtime_min", 0, v))
+	input.RuntimeMax = int32(app.readInt(qs, "runtime_max", 0, v))
+
+	// Facet counts are optional, since they take an extra query to work out.
+	input.Facets = app.readCSV(qs, "facets", []string{})
+
 	// Get the page and page_size query string values as integers. Notice that we set
 	// the default page value to 1 and default page_size to 20, and that we pass the
 	// validator instance as the final argument here.
@@ -220,21 +517,127 @@ func (app *application) listMoviesHandler(w http.ResponseWriter, r *http.Request
 	input.Filters.Sort = app.readString(qs, "sort", "id")
 
 	input.Filters.SortSafelist = []string{
-		"id", "title", "year", "runtime", "-id", "-title", "-year", "-runtime",
+		"id", "title", "year", "runtime", "-id", "-title", "-year", "-runtime", "relevance",
+	}
+
+	// The cursor parameter takes the place of page, using one of the next_cursor or
+	// prev_cursor values from the metadata of an earlier response.
+	input.Filters.Cursor = app.readString(qs, "cursor", "")
+
+	// Counting every matching movie gets expensive for large results, so clients can
+	// ask for an estimate instead, or for no total at all. Cursor pages are usually
+	// fetched one after another, so they skip the count unless asked for it.
+	includeTotal := "true"
+	if input.Filters.Cursor != "" {
+		includeTotal = "false"
+	}
+
+	switch app.readString(qs, "include_total", includeTotal) {
+	case "true":
+		input.Filters.Total = data.TotalExact
+	case "false":
+		input.Filters.Total = data.TotalNone
+	case "estimated":
+		input.Filters.Total = data.TotalEstimated
+	default:
+		v.AddError("include_total", "must be true, false or estimated")
+	}
+
+	v.Check(input.PersonID >= 0, "person_id", "must be a positive integer")
+	v.Check(input.FranchiseID >= 0, "franchise", "must be a positive integer")
+	v.Check(input.Filters.Cursor == "" || !qs.Has("page"), "cursor", "cannot be used together with page")
+	v.Check(input.Filters.Sort != "relevance" || input.Title != "", "sort", "relevance requires a title to search for")
+
+	// Genres can be given by name or alias, but movies are stored with the slugs.
+	taxonomy, err := app.models.Genres.Taxonomy()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	input.Genres = data.CanonicalGenreFilter(v, "genres", input.Genres, taxonomy)
+	input.ExcludeGenres = data.CanonicalGenreFilter(v, "exclude_genres", input.ExcludeGenres, taxonomy)
+
+	data.ValidateMovieCriteria(v, input.MovieCriteria)
+
+	for _, facet := range input.Facets {
+		v.Check(validator.PermittedValue(facet, data.FacetSafelist...), "facets", "must only contain genres or decade")
 	}
+	v.Check(validator.Unique(input.Facets), "facets", "must not contain duplicate values")
 
 	if data.ValidateFilters(v, input.Filters); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	movies, metadata, err := app.models.Movies.GetAll(input.Title, input.Genres, input.Filters)
+	// The certification can only be checked against the country's certifications
+	// once the country itself is known to be valid.
+	if input.MaxCertification != "" {
+		certifications, err := app.models.Releases.Certifications()
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		if _, ok := certifications.Rank(input.Country, input.MaxCertification); !ok {
+			v.AddError("max_certification", "must be one of the certifications used in the country")
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+	}
+
+	includeUnpublished, err := app.canSeeUnpublished(r)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	input.IncludeUnpublished = includeUnpublished
+
+	// Count the facets alongside fetching the page of movies, so that asking for
+	// them doesn't make the response any slower than the slower of the two queries.
+	var (
+		facets    map[string][]data.FacetCount
+		facetsErr error
+		wg        sync.WaitGroup
+	)
+
+	if len(input.Facets) > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			facets, facetsErr = app.models.Movies.GetFacets(input.MovieCriteria, input.Facets)
+		}()
+	}
+
+	movies, metadata, err := app.models.Movies.GetAll(input.MovieCriteria, input.Filters)
+	wg.Wait()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if facetsErr != nil {
+		app.serverErrorResponse(w, r, facetsErr)
+		return
+	}
+
+	err = app.attachImages(movies...)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelop{"movies": movies, "metadata": metadata}, nil)
+	err = app.localizeMovies(w, r, movies...)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	env := envelop{"movies": movies, "metadata": metadata}
+	if facets != nil {
+		env["facets"] = facets
+	}
+
+	err = app.writeJSON(w, http.StatusOK, env, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
@@ -242,3 +645,60 @@ func (app *application) listMoviesHandler(w http.ResponseWriter, r *http.Request
 	// Dump the contents of the input struct in a HTTP response.
 	// fmt.Fprintf(w, "%+v\n", input)
 }
+
+func (app *application) listDeletedMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		data.Filters
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	// The trash is always ordered by deletion time, so only the page and page_size
+	// parameters are accepted.
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = "-deleted_at"
+	input.Filters.SortSafelist = []string{"-deleted_at"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	movies, metadata, err := app.models.Movies.GetAllDeleted(input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelop{"movies": movies, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) restoreMovieHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	movie, err := app.models.Movies.Restore(id, app.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelop{"movie": movie}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
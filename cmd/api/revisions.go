@@ -0,0 +1,195 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"net/http"
+
+	"github.com/markponce/greenlight/internal/data"
+	"github.com/markponce/greenlight/internal/validator"
+)
+
+// getRevisionForRequest fetches the revision identified by the :id and :version URL
+// parameters. Revisions of unpublished movies are treated as missing for users who
+// can't see the movies. If anything goes wrong, the error response has already been
+// sent and the returned bool is false.
+func (app *application) getRevisionForRequest(w http.ResponseWriter, r *http.Request) (*data.MovieRevision, bool) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	version, err := app.readInt64Param(r, "version")
+	if err != nil || version > math.MaxInt32 {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	visible, err := app.canSeeUnpublished(r)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return nil, false
+	}
+
+	revision, err := app.models.Revisions.Get(id, int32(version), visible)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	return revision, true
+}
+
+func (app *application) listMovieRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		data.Filters
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	// Revisions are always listed newest first.
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = "-version"
+	input.Filters.SortSafelist = []string{"-version"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	visible, err := app.canSeeUnpublished(r)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	revisions, metadata, err := app.models.Revisions.GetAllForMovie(id, visible, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// A movie with no history at all doesn't exist (or has been purged).
+	if len(revisions) == 0 && input.Filters.Page == 1 {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelop{"revisions": revisions, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showMovieRevisionHandler(w http.ResponseWriter, r *http.Request) {
+	revision, ok := app.getRevisionForRequest(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.writeJSON(w, http.StatusOK, envelop{"revision": revision}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// diffMovieRevisionHandler compares the revision in the URL with the one given by
+// the "from" query string parameter, which defaults to the revision immediately
+// before it.
+func (app *application) diffMovieRevisionHandler(w http.ResponseWriter, r *http.Request) {
+	to, ok := app.getRevisionForRequest(w, r)
+	if !ok {
+		return
+	}
+
+	v := validator.New()
+
+	from := app.readInt(r.URL.Query(), "from", 0, v)
+	v.Check(from >= 0, "from", "must be a positive integer")
+	v.Check(from <= math.MaxInt32, "from", "must be a valid version")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	var (
+		previous *data.MovieRevision
+		err      error
+	)
+
+	// Having found the revision in the URL, the user can see the movie's history.
+	if from == 0 {
+		previous, err = app.models.Revisions.GetPrevious(to.MovieID, to.Version, true)
+	} else {
+		previous, err = app.models.Revisions.Get(to.MovieID, int32(from), true)
+	}
+
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound) && from == 0:
+			v.AddError("from", "must be provided for the first revision")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("from", "must refer to an existing revision")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	diff := envelop{
+		"from":    previous.Version,
+		"to":      to.Version,
+		"changes": data.DiffRevisions(previous, to),
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelop{"diff": diff}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// revertMovieHandler restores a movie's fields to how they were at the given
+// revision. The change is saved as a normal update, so it's validated, checked for
+// edit conflicts and recorded as a new revision.
+func (app *application) revertMovieHandler(w http.ResponseWriter, r *http.Request) {
+	revision, ok := app.getRevisionForRequest(w, r)
+	if !ok {
+		return
+	}
+
+	movie, err := app.models.Movies.Get(revision.MovieID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	movie.Title = revision.Title
+	movie.Year = revision.Year
+	movie.Runtime = revision.Runtime
+	movie.Genres = revision.Genres
+
+	app.saveMovie(w, r, movie, http.StatusOK)
+}
@@ -5,6 +5,7 @@ import (
 	"net/http"
 
 	"github.com/julienschmidt/httprouter"
+	"github.com/markponce/greenlight/internal/storage"
 )
 
 func (app *application) routes() http.Handler {
@@ -21,18 +22,120 @@ func (app *application) routes() http.Handler {
 
 	router.HandlerFunc(http.MethodGet, "/v1/movies", app.requirePermission("movies:read", app.listMoviesHandler))
 	router.HandlerFunc(http.MethodPost, "/v1/movies", app.requirePermission("movies:write", app.createMovieHandler))
-	router.HandlerFunc(http.MethodGet, "/v1/movies/:id", app.requirePermission("movies:read", app.showMovieHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id", app.staticSegments(map[string]http.HandlerFunc{
+		"bulk":   app.requirePermission("movies:write", app.bulkMoviesHandler),
+		"import": app.requirePermission("movies:write", app.importMoviesHandler),
+	}, app.methodNotAllowedResponse))
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id", app.staticSegments(map[string]http.HandlerFunc{
+		"duplicates": app.requirePermission("movies:admin", app.listDuplicateMoviesHandler),
+		"export":     app.requirePermission("movies:read", app.exportMoviesHandler),
+		"merges":     app.requirePermission("movies:admin", app.listMovieMergesHandler),
+		"suggest":    app.rateLimitSuggestions(app.requirePermission("movies:read", app.suggestMoviesHandler)),
+		"trash":      app.requirePermission("movies:admin", app.listDeletedMoviesHandler),
+	}, app.requirePermission("movies:read", app.showMovieHandler)))
+	router.HandlerFunc(http.MethodPut, "/v1/movies/:id", app.requirePermission("movies:write", app.replaceMovieHandler))
 	router.HandlerFunc(http.MethodPatch, "/v1/movies/:id", app.requirePermission("movies:write", app.updateMovieHandler))
 	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id", app.requirePermission("movies:write", app.deleteMovieHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id/restore", app.requirePermission("movies:admin", app.restoreMovieHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id/merge", app.requirePermission("movies:admin", app.mergeMovieHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/revisions", app.requirePermission("movies:read", app.listMovieRevisionsHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/revisions/:version", app.requirePermission("movies:read", app.showMovieRevisionHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/revisions/:version/diff", app.requirePermission("movies:read", app.diffMovieRevisionHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id/revisions/:version/revert", app.requirePermission("movies:write", app.revertMovieHandler))
+
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id/images", app.requirePermission("movies:write", app.uploadMovieImageHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id/images/:image_id", app.requirePermission("movies:write", app.deleteMovieImageHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/translations", app.requirePermission("movies:read", app.listMovieTranslationsHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/movies/:id/translations/:locale", app.requirePermission("movies:write", app.putMovieTranslationHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id/translations/:locale", app.requirePermission("movies:write", app.deleteMovieTranslationHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/releases", app.requirePermission("movies:read", app.listMovieReleasesHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/movies/:id/releases/:country", app.requirePermission("movies:write", app.putMovieReleaseHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id/releases/:country", app.requirePermission("movies:write", app.deleteMovieReleaseHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/similar", app.requirePermission("movies:read", app.listSimilarMoviesHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/credits", app.requirePermission("movies:read", app.listMovieCreditsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id/credits", app.requirePermission("movies:write", app.addMovieCreditHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id/credits", app.requirePermission("movies:write", app.removeMovieCreditHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/genres", app.requirePermission("movies:read", app.listGenresHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/genres", app.requirePermission("movies:admin", app.createGenreHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/genres/:id", app.requirePermission("movies:read", app.showGenreHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/genres/:id", app.requirePermission("movies:admin", app.updateGenreHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/genres/:id", app.requirePermission("movies:admin", app.deleteGenreHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/people", app.requirePermission("movies:read", app.listPeopleHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/people", app.requirePermission("movies:write", app.createPersonHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/people/:id", app.requirePermission("movies:read", app.showPersonHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/people/:id", app.requirePermission("movies:write", app.updatePersonHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/people/:id", app.requirePermission("movies:write", app.deletePersonHandler))
 
 	router.HandlerFunc(http.MethodPost, "/v1/users", app.registerUserHandler)
 	router.HandlerFunc(http.MethodPut, "/v1/users/activated", app.activateUserHandler)
 	router.HandlerFunc(http.MethodPost, "/v1/users/resend-activation", app.resendActivationHandler)
 
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/watchlist", app.requirePermission("movies:read", app.listWatchlistHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/users/me/watchlist", app.requirePermission("movies:read", app.addWatchlistEntryHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/users/me/watchlist/:id", app.requirePermission("movies:read", app.updateWatchlistEntryHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me/watchlist/:id", app.requirePermission("movies:read", app.removeWatchlistEntryHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/certifications", app.requirePermission("movies:read", app.listCertificationsHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/franchises", app.requirePermission("movies:read", app.listFranchisesHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/franchises", app.requirePermission("movies:write", app.createFranchiseHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/franchises/:id", app.requirePermission("movies:read", app.showFranchiseHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/franchises/:id", app.requirePermission("movies:write", app.updateFranchiseHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/franchises/:id", app.requirePermission("movies:write", app.deleteFranchiseHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/franchises/:id/movies", app.requirePermission("movies:write", app.addFranchiseMovieHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/franchises/:id/movies", app.requirePermission("movies:write", app.reorderFranchiseHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/franchises/:id/movies/:movie_id", app.requirePermission("movies:write", app.removeFranchiseMovieHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/submissions", app.requirePermission("movies:moderate", app.listSubmissionsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/submissions", app.requireActivatedUser(app.createSubmissionHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/submissions/:id", app.requireActivatedUser(app.showSubmissionHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/submissions/:id/approve", app.requirePermission("movies:moderate", app.approveSubmissionHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/submissions/:id/reject", app.requirePermission("movies:moderate", app.rejectSubmissionHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/submissions", app.requireActivatedUser(app.listUserSubmissionsHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/lists", app.requirePermission("movies:read", app.listListsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/lists", app.requirePermission("movies:read", app.createListHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/lists/:id", app.requirePermission("movies:read", app.showListHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/lists/:id", app.requirePermission("movies:read", app.updateListHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/lists/:id", app.requirePermission("movies:read", app.deleteListHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/lists/:id/movies", app.requirePermission("movies:read", app.addListMovieHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/lists/:id/movies", app.requirePermission("movies:read", app.reorderListHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/lists/:id/movies/:movie_id", app.requirePermission("movies:read", app.removeListMovieHandler))
+
 	router.HandlerFunc(http.MethodPost, "/v1/tokens/authentication", app.createAuthenticationTokenHandler)
 
 	router.Handler(http.MethodGet, "/debug/vars", expvar.Handler())
 
+	// Images kept on the local filesystem are served by the API itself.
+	if local, ok := app.images.(*storage.Local); ok {
+		router.Handler(http.MethodGet, "/images/*path", http.StripPrefix("/images", local.Handler()))
+	}
+
 	// Wrap the router with the panic recovery middleware.
 	return app.metrics(app.recoverPanic(app.enableCORS(app.rateLimit(app.authenticate(router)))))
 }
+
+// httprouter doesn't allow a static path segment to share a position with a named
+// parameter, so routes like GET /v1/movies/trash can't be registered alongside GET
+// /v1/movies/:id. Instead the static segments are registered on the :id route and the
+// staticSegments() helper dispatches to their handlers by name, falling back to next
+// for anything else.
+func (app *application) staticSegments(handlers map[string]http.HandlerFunc, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := httprouter.ParamsFromContext(r.Context())
+
+		if handler, ok := handlers[params.ByName("id")]; ok {
+			handler(w, r)
+			return
+		}
+
+		next(w, r)
+	}
+}
@@ -57,8 +57,9 @@ func (app *application) serve() error {
 			shutdownError <- err
 		}
 
-		// Log a message to say that we're waiting for any background goroutines to
-		// complete their tasks.
+		// Tell the background jobs to stop, then log a message to say that we're
+		// waiting for any background goroutines to complete their tasks.
+		close(app.shutdown)
 		app.logger.Info("completing background tasks", "addr", srv.Addr)
 
 		// Call Wait() to block until our WaitGroup counter is zero --- essentially
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/markponce/greenlight/internal/data"
+	"github.com/markponce/greenlight/internal/validator"
+)
+
+// listSimilarMoviesHandler returns the movies most similar to the one identified by
+// the :id URL parameter. Similarities are computed in the background by
+// recomputeSimilarities(), so a movie which has only just been created or changed
+// may briefly have none or out of date ones.
+func (app *application) listSimilarMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		data.Filters
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "-score")
+	input.Filters.SortSafelist = []string{"score", "title", "year", "-score", "-title", "-year"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Make sure the movie exists, so that an unknown ID gets a 404 rather than an
+	// empty list of movies.
+	if _, ok := app.getVisibleMovie(w, r, id); !ok {
+		return
+	}
+
+	movies, metadata, err := app.models.Similarities.GetSimilar(id, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	localized := make([]*data.Movie, len(movies))
+	for i, movie := range movies {
+		localized[i] = &movie.Movie
+	}
+
+	err = app.localizeMovies(w, r, localized...)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelop{"movies": movies, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,388 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/markponce/greenlight/internal/data"
+	"github.com/markponce/greenlight/internal/validator"
+)
+
+// submissionInput holds the fields of a movie which a submission changes, as sent
+// when proposing a new movie or an edit, or when a moderator edits a submission
+// before approving it. Fields which are left out aren't changed.
+type submissionInput struct {
+	Title   *string       `json:"title"`
+	Year    *int32        `json:"year"`
+	Runtime *data.Runtime `json:"runtime"`
+	Genres  []string      `json:"genres"`
+}
+
+// empty reports whether the input doesn't change anything.
+func (input submissionInput) empty() bool {
+	return input.Title == nil && input.Year == nil && input.Runtime == nil && input.Genres == nil
+}
+
+// apply makes the changes in the input to the movie.
+func (input submissionInput) apply(movie *data.Movie) {
+	if input.Title != nil {
+		movie.Title = *input.Title
+	}
+
+	if input.Year != nil {
+		movie.Year = *input.Year
+	}
+
+	if input.Runtime != nil {
+		movie.Runtime = *input.Runtime
+	}
+
+	if input.Genres != nil {
+		movie.Genres = input.Genres
+	}
+}
+
+// getSubmissionForRequest fetches the submission identified by the :id URL parameter.
+// If anything goes wrong, the error response has already been sent and the returned
+// bool is false.
+func (app *application) getSubmissionForRequest(w http.ResponseWriter, r *http.Request) (*data.Submission, bool) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	submission, err := app.models.Submissions.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	return submission, true
+}
+
+// notifySubmitter emails the user who made a submission to let them know that it
+// has been reviewed, using the given template.
+func (app *application) notifySubmitter(submission *data.Submission, templateFile string) {
+	app.Background(func() {
+		data := map[string]any{
+			"submissionID": submission.ID,
+			"kind":         submission.Kind,
+			"title":        submission.Movie.Title,
+			"movieID":      submission.Movie.ID,
+			"reason":       submission.Reason,
+		}
+
+		err := app.mailer.Send(submission.UserEmail, templateFile, data)
+		if err != nil {
+			app.logger.Error(err.Error())
+		}
+	})
+}
+
+// createSubmissionHandler adds a proposed movie to the moderation queue, or a proposed
+// edit when the movie_id of an existing movie is given. For example:
+//
+//	curl -d '{"movie_id":1,"runtime":"107 mins"}' localhost:4000/v1/submissions
+func (app *application) createSubmissionHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		MovieID int64 `json:"movie_id"`
+		submissionInput
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	submission := &data.Submission{
+		UserID: app.contextGetUser(r).ID,
+		Kind:   data.OperationCreate,
+		Movie:  &data.Movie{},
+	}
+
+	if input.MovieID != 0 {
+		movie, err := app.models.Movies.Get(input.MovieID)
+		if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		// Movies the user can't see can't be edited either.
+		if movie != nil && movie.Status != data.StatusPublished {
+			visible, err := app.canSeeUnpublished(r)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+
+			if !visible {
+				movie = nil
+			}
+		}
+
+		v.Check(movie != nil, "movie_id", "must refer to an existing movie")
+		v.Check(!input.empty(), "movie", "must change at least one field")
+
+		if !v.Valid() {
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		submission.Kind = data.OperationUpdate
+		submission.Movie = movie
+	}
+
+	input.apply(submission.Movie)
+
+	taxonomy, err := app.models.Genres.Taxonomy()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if data.ValidateMovie(v, submission.Movie, taxonomy); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Submissions.Insert(submission)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/submissions/%d", submission.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelop{"submission": submission}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// showSubmissionHandler shows a submission to the user who made it, or to a moderator.
+func (app *application) showSubmissionHandler(w http.ResponseWriter, r *http.Request) {
+	submission, ok := app.getSubmissionForRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if submission.UserID != app.contextGetUser(r).ID {
+		permissions, err := app.models.Permissions.GetAllForUser(app.contextGetUser(r).ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		// Other users' submissions are treated as missing, rather than forbidden, so
+		// as not to give away which ones exist.
+		if !permissions.Include("movies:moderate") {
+			app.notFoundResponse(w, r)
+			return
+		}
+	}
+
+	err := app.writeJSON(w, http.StatusOK, envelop{"submission": submission}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listSubmissionsHandler lists the moderation queue, oldest first. Reviewed
+// submissions can be listed with the status parameter.
+func (app *application) listSubmissionsHandler(w http.ResponseWriter, r *http.Request) {
+	app.listSubmissions(w, r, 0, data.SubmissionPending, "created_at")
+}
+
+// listUserSubmissionsHandler lists the submissions made by the user, most recent
+// first, whatever their status unless the status parameter is given.
+func (app *application) listUserSubmissionsHandler(w http.ResponseWriter, r *http.Request) {
+	app.listSubmissions(w, r, app.contextGetUser(r).ID, "", "-created_at")
+}
+
+// listSubmissions sends a page of submissions, narrowed down to those made by a user
+// if userID is non-zero. The status and sort parameters default to the given values.
+func (app *application) listSubmissions(w http.ResponseWriter, r *http.Request, userID int64, status, sort string) {
+	var input struct {
+		Status string
+		data.Filters
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	input.Status = app.readString(qs, "status", status)
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", sort)
+	input.Filters.SortSafelist = []string{"id", "created_at", "reviewed_at", "-id", "-created_at", "-reviewed_at"}
+
+	v.Check(input.Status == "" || validator.PermittedValue(input.Status, data.SubmissionPending, data.SubmissionApproved, data.SubmissionRejected), "status", "must be one of pending, approved or rejected")
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	submissions, metadata, err := app.models.Submissions.GetAll(userID, input.Status, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelop{"submissions": submissions, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// approveSubmissionHandler approves a submission, saving the movie it proposes. The
+// body holds any changes the moderator wants to make first, in the same form as a
+// submission, so an empty object approves the submission as it is. A proposed edit
+// can only be approved while the movie is still at the version it was proposed
+// against, as otherwise saving it would undo the changes made since; a 409 Conflict
+// response is sent instead, and the submission should be rejected and resubmitted.
+func (app *application) approveSubmissionHandler(w http.ResponseWriter, r *http.Request) {
+	submission, ok := app.getSubmissionForRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var input submissionInput
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if submission.Status != data.SubmissionPending {
+		app.submissionReviewedResponse(w, r)
+		return
+	}
+
+	v := validator.New()
+
+	if submission.Kind == data.OperationUpdate {
+		var movie *data.Movie
+
+		// The movie being edited may have been deleted since the edit was proposed,
+		// in which case its ID is no longer recorded.
+		if submission.Movie.ID != 0 {
+			movie, err = app.models.Movies.Get(submission.Movie.ID)
+			if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+		}
+
+		if movie == nil {
+			v.AddError("movie", "no longer exists")
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		if movie.Vesion != submission.Movie.Vesion {
+			app.editConflictResponse(w, r)
+			return
+		}
+
+		movie.Title = submission.Movie.Title
+		movie.Year = submission.Movie.Year
+		movie.Runtime = submission.Movie.Runtime
+		movie.Genres = submission.Movie.Genres
+
+		submission.Movie = movie
+	}
+
+	input.apply(submission.Movie)
+
+	taxonomy, err := app.models.Genres.Taxonomy()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if data.ValidateMovie(v, submission.Movie, taxonomy); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Submissions.Approve(submission, app.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		case errors.Is(err, data.ErrSubmissionReviewed):
+			app.submissionReviewedResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.notifySubmitter(submission, "submission_approved.tmpl.html")
+
+	err = app.writeJSON(w, http.StatusOK, envelop{"submission": submission}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// rejectSubmissionHandler rejects a submission. The body must give a reason, which
+// is stored with the submission and sent to the submitter in the email telling them
+// it was rejected. A submission can only be reviewed once, so a 409 Conflict
+// response is sent if it has already been approved or rejected.
+func (app *application) rejectSubmissionHandler(w http.ResponseWriter, r *http.Request) {
+	submission, ok := app.getSubmissionForRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Reason string `json:"reason"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if data.ValidateRejection(v, input.Reason); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Submissions.Reject(submission, input.Reason, app.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrSubmissionReviewed):
+			app.submissionReviewedResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.notifySubmitter(submission, "submission_rejected.tmpl.html")
+
+	err = app.writeJSON(w, http.StatusOK, envelop{"submission": submission}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
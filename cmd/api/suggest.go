@@ -0,0 +1,120 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/markponce/greenlight/internal/data"
+	"github.com/markponce/greenlight/internal/validator"
+)
+
+const (
+	// suggestionCacheTTL is how long suggestions are cached for. It's kept short, so
+	// that new and renamed movies show up soon after they're saved.
+	suggestionCacheTTL = 30 * time.Second
+	// suggestionCacheSize is the most queries the cache holds at once.
+	suggestionCacheSize = 10_000
+)
+
+// suggestionCache holds recent title suggestions in memory, keyed by the normalized
+// query, so that popular prefixes don't hit the database on every keystroke.
+type suggestionCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	size    int
+	entries map[string]suggestionCacheEntry
+}
+
+type suggestionCacheEntry struct {
+	suggestions []*data.MovieSuggestion
+	expires     time.Time
+}
+
+func newSuggestionCache(ttl time.Duration, size int) *suggestionCache {
+	return &suggestionCache{
+		ttl:     ttl,
+		size:    size,
+		entries: make(map[string]suggestionCacheEntry),
+	}
+}
+
+func (c *suggestionCache) get(key string) ([]*data.MovieSuggestion, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok || time.Now().After(entry.expires) {
+		return nil, false
+	}
+
+	return entry.suggestions, true
+}
+
+func (c *suggestionCache) set(key string, suggestions []*data.MovieSuggestion) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// When the cache is full, make room by dropping the expired entries, or all of
+	// them if none have expired yet.
+	if len(c.entries) >= c.size {
+		now := time.Now()
+
+		for key, entry := range c.entries {
+			if now.After(entry.expires) {
+				delete(c.entries, key)
+			}
+		}
+
+		if len(c.entries) >= c.size {
+			clear(c.entries)
+		}
+	}
+
+	c.entries[key] = suggestionCacheEntry{
+		suggestions: suggestions,
+		expires:     time.Now().Add(c.ttl),
+	}
+}
+
+// suggestMoviesHandler returns the titles matching what's been typed into a search
+// box so far, as in GET /v1/movies/suggest?q=mo&limit=5.
+func (app *application) suggestMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	qs := r.URL.Query()
+
+	q := strings.Join(strings.Fields(strings.ToLower(app.readString(qs, "q", ""))), " ")
+	limit := app.readInt(qs, "limit", 10, v)
+
+	v.Check(q != "", "q", "must be provided")
+	v.Check(len(q) <= 100, "q", "must not be more than 100 bytes long")
+	v.Check(limit > 0, "limit", "must be greater than zero")
+	v.Check(limit <= 20, "limit", "must be a maximum of 20")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	key := strconv.Itoa(limit) + ":" + q
+
+	suggestions, ok := app.suggestions.get(key)
+	if !ok {
+		var err error
+
+		suggestions, err = app.models.Movies.Suggest(q, limit)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		app.suggestions.set(key, suggestions)
+	}
+
+	err := app.writeJSON(w, http.StatusOK, envelop{"suggestions": suggestions}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
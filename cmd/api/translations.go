@@ -0,0 +1,199 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/markponce/greenlight/internal/data"
+	"github.com/markponce/greenlight/internal/validator"
+	"golang.org/x/text/language"
+)
+
+// requestLocales returns the locales the client would like movies in, most preferred
+// first. They're taken from the lang query string parameter, which can hold a comma
+// separated list, or failing that from the Accept-Language header. Each locale is
+// followed by the more general ones it falls back to, so "pt-BR" also brings in "pt".
+// Values which aren't valid language tags are ignored.
+func (app *application) requestLocales(r *http.Request) []string {
+	var tags []language.Tag
+
+	if lang := r.URL.Query().Get("lang"); lang != "" {
+		for _, s := range strings.Split(lang, ",") {
+			tag, err := language.Parse(strings.TrimSpace(s))
+			if err == nil {
+				tags = append(tags, tag)
+			}
+		}
+	} else {
+		tags, _, _ = language.ParseAcceptLanguage(r.Header.Get("Accept-Language"))
+	}
+
+	var locales []string
+
+	for _, tag := range tags {
+		// The * wildcard in Accept-Language is parsed as "mul", for multiple
+		// languages, which no translation will be stored under.
+		if tag == language.MustParse("mul") {
+			continue
+		}
+
+		for ; tag != language.Und; tag = tag.Parent() {
+			if locale := tag.String(); !slices.Contains(locales, locale) {
+				locales = append(locales, locale)
+			}
+		}
+	}
+
+	return locales
+}
+
+// localizeMovies replaces the titles of the movies with their translations in the
+// locales the client asked for, where they have one. Movies without a suitable
+// translation keep the title they were stored with.
+func (app *application) localizeMovies(w http.ResponseWriter, r *http.Request, movies ...*data.Movie) error {
+	// The response depends on the Accept-Language header even if it didn't change
+	// anything this time, so caches need to know to take it into account.
+	w.Header().Add("Vary", "Accept-Language")
+
+	locales := app.requestLocales(r)
+	if len(locales) == 0 || len(movies) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, len(movies))
+	for i, movie := range movies {
+		ids[i] = movie.ID
+	}
+
+	translations, err := app.models.Translations.GetBestForMovies(ids, locales)
+	if err != nil {
+		return err
+	}
+
+	for _, movie := range movies {
+		t, ok := translations[movie.ID]
+		if !ok {
+			continue
+		}
+
+		movie.OriginalTitle = movie.Title
+		movie.Title = t.Title
+		movie.Synopsis = t.Synopsis
+		movie.Locale = t.Locale
+	}
+
+	return nil
+}
+
+func (app *application) listMovieTranslationsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	// Make sure the movie exists, so that an unknown ID gets a 404 rather than an
+	// empty list of translations.
+	if _, ok := app.getVisibleMovie(w, r, id); !ok {
+		return
+	}
+
+	translations, err := app.models.Translations.GetForMovie(id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelop{"translations": translations}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// putMovieTranslationHandler adds or replaces the translation of a movie for the
+// locale in the :locale URL parameter.
+func (app *application) putMovieTranslationHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Title    string `json:"title"`
+		Synopsis string `json:"synopsis"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	translation := &data.Translation{
+		MovieID:  id,
+		Locale:   httprouter.ParamsFromContext(r.Context()).ByName("locale"),
+		Title:    input.Title,
+		Synopsis: input.Synopsis,
+	}
+
+	v := validator.New()
+
+	if data.ValidateTranslation(v, translation); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Locales are stored in their canonical form so that they match the ones worked
+	// out from requests.
+	translation.Locale, _ = data.CanonicalLocale(translation.Locale)
+
+	err = app.models.Translations.Upsert(translation, app.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelop{"translation": translation}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteMovieTranslationHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	locale, ok := data.CanonicalLocale(httprouter.ParamsFromContext(r.Context()).ByName("locale"))
+	if !ok {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Translations.Delete(id, locale, app.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelop{"message": "translation successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -1,7 +1,137 @@
 package main
 
-import "fmt"
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/markponce/greenlight/internal/data"
+	"github.com/markponce/greenlight/internal/importer"
+
+	_ "github.com/lib/pq"
+)
+
+const usage = `Usage: cli <command> [flags]
+
+Commands:
+  import    import movies from a CSV or NDJSON file
+`
 
 func main() {
-	fmt.Println("CLI!")
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	var err error
+
+	switch os.Args[1] {
+	case "import":
+		err = importCmd(os.Args[2:])
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// importCmd imports movies from the file named in args, or from stdin if the name is
+// "-", and prints the report as JSON. For example:
+//
+//	go run ./cmd/cli import -format=csv -dry-run -columns=title=Name,year=Released movies.csv
+func importCmd(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+
+	dsn := fs.String("db-dsn", os.Getenv("GREENLIGHT_DB_DSN"), "PostgreSQL DSN")
+	format := fs.String("format", importer.FormatCSV, "Input format (csv|ndjson)")
+	dryRun := fs.Bool("dry-run", false, "Validate the input without inserting anything")
+	upsert := fs.Bool("upsert", false, "Update existing movies with the same title and year")
+	columns := fs.String("columns", "", "Column mapping, like title=Name,year=Released")
+	batchSize := fs.Int("batch-size", 500, "Number of movies inserted per statement")
+
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: cli import [flags] <file>")
+	}
+
+	opts := importer.Options{
+		Format:    *format,
+		DryRun:    *dryRun,
+		Upsert:    *upsert,
+		BatchSize: *batchSize,
+	}
+
+	var err error
+
+	opts.Columns, err = importer.ParseColumns(*columns)
+	if err != nil {
+		return err
+	}
+
+	var r io.Reader = os.Stdin
+
+	if name := fs.Arg(0); name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		r = f
+	}
+
+	// Even a dry run needs the database, to check the genres against the taxonomy.
+	db, err := openDB(*dsn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	models := data.NewModel(db)
+
+	opts.Taxonomy, err = models.Genres.Taxonomy()
+	if err != nil {
+		return err
+	}
+
+	report, err := importer.Run(r, &models.Movies, opts)
+
+	// Print the report even if the import failed partway through, so that it's clear
+	// how much was written.
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "\t")
+
+	if encErr := enc.Encode(report); encErr != nil {
+		return encErr
+	}
+
+	return err
+}
+
+func openDB(dsn string) (*sql.DB, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err = db.PingContext(ctx)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
 }
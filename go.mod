@@ -12,4 +12,4 @@ require (
 	golang.org/x/time v0.11.0
 )
 
-require golang.org/x/text v0.23.0 // indirect
+require golang.org/x/text v0.23.0
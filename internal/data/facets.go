@@ -0,0 +1,104 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// The facets that movie counts can be broken down by.
+const (
+	FacetGenres = "genres"
+	FacetDecade = "decade"
+)
+
+// FacetSafelist holds the facet names accepted by GetFacets().
+var FacetSafelist = []string{FacetGenres, FacetDecade}
+
+// FacetCount is the number of movies with a particular facet value, such as the
+// number of dramas, or the number of movies from the 1990s.
+type FacetCount struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// GetFacets counts the movies matching the criteria for each value of the given
+// facets, most common values first. Every facet is counted in a single query over
+// the matching movies. Genres are counted per genre, so a movie with several genres
+// is counted once for each of them.
+func (m *MovieModel) GetFacets(criteria MovieCriteria, facets []string) (map[string][]FacetCount, error) {
+	conditions, args := criteria.where()
+
+	var selects []string
+
+	for _, facet := range facets {
+		switch facet {
+		case FacetGenres:
+			selects = append(selects, `
+		SELECT 'genres', genre, count(*)
+		FROM matching, unnest(matching.genres) AS genre
+		GROUP BY genre`)
+		case FacetDecade:
+			selects = append(selects, `
+		SELECT 'decade', (matching.year / 10 * 10)::text || 's', count(*)
+		FROM matching
+		GROUP BY matching.year / 10`)
+		default:
+			return nil, fmt.Errorf("unknown facet %q", facet)
+		}
+	}
+
+	result := make(map[string][]FacetCount, len(facets))
+
+	if len(selects) == 0 {
+		return result, nil
+	}
+
+	query := fmt.Sprintf(`
+	WITH matching AS (
+		SELECT movies.genres, movies.year
+		FROM movies
+		WHERE %s
+	)
+	SELECT facet, value, count FROM (%s
+	) AS facets (facet, value, count)
+	ORDER BY facet, count DESC, value ASC`,
+		conditions,
+		strings.Join(selects, "\n\t\tUNION ALL"),
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// Requested facets with no matching movies still appear, with an empty list.
+	for _, facet := range facets {
+		result[facet] = []FacetCount{}
+	}
+
+	for rows.Next() {
+		var (
+			facet string
+			count FacetCount
+		)
+
+		err := rows.Scan(&facet, &count.Value, &count.Count)
+		if err != nil {
+			return nil, err
+		}
+
+		result[facet] = append(result[facet], count)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
@@ -1,6 +1,9 @@
 package data
 
 import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"math"
 	"strings"
 
@@ -12,8 +15,22 @@ type Filters struct {
 	PageSize     int
 	Sort         string
 	SortSafelist []string
+	// Cursor, when set, is used instead of Page to fetch the page before or after a
+	// given row. Only lists which support keyset pagination look at it.
+	Cursor string
+	// Total says how the total number of records should be counted, using one of the
+	// Total* constants. Only lists which support skipping the count look at it, and
+	// the zero value means an exact count.
+	Total string
 }
 
+// The ways of counting the total number of records in a list.
+const (
+	TotalExact     = "exact"
+	TotalEstimated = "estimated"
+	TotalNone      = "none"
+)
+
 func ValidateFilters(v *validator.Validator, f Filters) {
 
 	v.Check(f.Page > 0, "page", "must be greater than zero")
@@ -23,6 +40,16 @@ func ValidateFilters(v *validator.Validator, f Filters) {
 
 	// Check that the sort parameter matches a value in the safelist.
 	v.Check(validator.PermittedValue(f.Sort, f.SortSafelist...), "sort", "invalid sort value")
+
+	// A cursor only makes sense for the sort order it was handed out with.
+	if f.Cursor != "" {
+		c, err := decodeCursor(f.Cursor)
+		if err != nil {
+			v.AddError("cursor", "must be a valid cursor")
+		} else {
+			v.Check(c.Sort == f.Sort, "cursor", "does not match the sort value")
+		}
+	}
 }
 
 func (f Filters) sortColumn() string {
@@ -50,21 +77,87 @@ func (f Filters) offfset() int {
 	return (f.Page - 1) * f.PageSize
 }
 
-// "current_page": 1,
-// "page_size": 20,
-// "first_page": 1,
-// "last_page": 42,
-// "total_records": 832
+// cursor marks a position in a list for keyset pagination, using the sort column
+// value and ID of a row. Before says whether the page wanted is the one before the
+// row or the one after it.
+type cursor struct {
+	Sort   string `json:"s"`
+	Value  string `json:"v"`
+	ID     int64  `json:"id"`
+	Before bool   `json:"b,omitempty"`
+}
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// encodeCursor turns a cursor into the opaque string handed to clients.
+func encodeCursor(c cursor) string {
+	js, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(js)
+}
+
+func decodeCursor(s string) (cursor, error) {
+	var c cursor
+
+	js, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, errInvalidCursor
+	}
+
+	err = json.Unmarshal(js, &c)
+	if err != nil || c.Sort == "" {
+		return c, errInvalidCursor
+	}
+
+	return c, nil
+}
+
+// cursorAfter returns a cursor for the page following the row with the given sort
+// column value and ID.
+func (f Filters) cursorAfter(value string, id int64) string {
+	return encodeCursor(cursor{Sort: f.Sort, Value: value, ID: id})
+}
+
+// cursorBefore returns a cursor for the page preceding the row with the given sort
+// column value and ID.
+func (f Filters) cursorBefore(value string, id int64) string {
+	return encodeCursor(cursor{Sort: f.Sort, Value: value, ID: id, Before: true})
+}
+
+// "CurrentPage": 1,
+// "PageSize": 20,
+// "FirstPage": 1,
+// "LastPage": 42,
+// "TotalRecords": 832
 
 type Metadata struct {
-	CurrentPage  int `json:current_page. omitzero`
-	PageSize     int `json:page_size. omitzero`
-	FirstPage    int `json:first_page. omitzero`
-	LastPage     int `json:last_page. omitzero`
-	TotalRecords int `json:total_records. omitzero`
+	CurrentPage  int `json:"CurrentPage"`
+	PageSize     int `json:"PageSize"`
+	FirstPage    int `json:"FirstPage"`
+	LastPage     int `json:"LastPage"`
+	TotalRecords int `json:"TotalRecords"`
+	// TotalRecordsAccuracy is either TotalExact or TotalEstimated, or TotalNone when
+	// the records weren't counted, in which case TotalRecords and LastPage are zero.
+	TotalRecordsAccuracy string `json:"TotalRecordsAccuracy,omitzero"`
+	// The cursors are only set when paging by cursor. Unlike the keys above, which
+	// keep the names existing clients already read, they're sent as next_cursor and
+	// prev_cursor.
+	NextCursor string `json:"next_cursor,omitzero"`
+	PrevCursor string `json:"prev_cursor,omitzero"`
 }
 
-func CalculateMetaData(totalRecords, page, pageSize int) Metadata {
+// CalculateMetaData works out the metadata for a page of records. The accuracy says
+// how totalRecords was arrived at: TotalExact, TotalEstimated, or TotalNone if the
+// records weren't counted at all.
+func CalculateMetaData(totalRecords, page, pageSize int, accuracy string) Metadata {
+	if accuracy == TotalNone {
+		return Metadata{
+			CurrentPage:          page,
+			PageSize:             pageSize,
+			FirstPage:            1,
+			TotalRecordsAccuracy: TotalNone,
+		}
+	}
+
 	if totalRecords == 0 {
 		return Metadata{}
 	}
@@ -74,7 +167,8 @@ func CalculateMetaData(totalRecords, page, pageSize int) Metadata {
 		PageSize:    pageSize,
 		FirstPage:   1,
 		// LastPage:     (totalRecords + pageSize - 1) / pageSize,
-		LastPage:     int(math.Ceil(float64(totalRecords) / float64(pageSize))),
-		TotalRecords: totalRecords,
+		LastPage:             int(math.Ceil(float64(totalRecords) / float64(pageSize))),
+		TotalRecords:         totalRecords,
+		TotalRecordsAccuracy: accuracy,
 	}
 }
@@ -0,0 +1,154 @@
+package data
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/markponce/greenlight/internal/validator"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		cursor cursor
+	}{
+		{name: "after", cursor: cursor{Sort: "title", Value: "Casablanca", ID: 12}},
+		{name: "before", cursor: cursor{Sort: "-year", Value: "1942", ID: 7, Before: true}},
+		{name: "empty value", cursor: cursor{Sort: "id", Value: "", ID: 1}},
+		{name: "unicode and url characters", cursor: cursor{Sort: "title", Value: "Amélie/?&=+ \"quoted\"", ID: 99}},
+		{name: "relevance", cursor: cursor{Sort: "-relevance", Value: "0.0607927", ID: 3}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoded := encodeCursor(tt.cursor)
+
+			// Cursors are passed in query strings, so they must not need escaping.
+			if strings.ContainsAny(encoded, "+/=") {
+				t.Errorf("encoded cursor %q is not URL safe", encoded)
+			}
+
+			decoded, err := decodeCursor(encoded)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if decoded != tt.cursor {
+				t.Errorf("got %+v; want %+v", decoded, tt.cursor)
+			}
+		})
+	}
+}
+
+func TestDecodeCursorInvalid(t *testing.T) {
+	raw := func(s string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(s))
+	}
+
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{name: "empty", input: ""},
+		{name: "not base64", input: "not a cursor!"},
+		{name: "padded", input: base64.URLEncoding.EncodeToString([]byte(`{"s":"id","v":"1","id":1}`))},
+		{name: "not json", input: raw("title:Casablanca:12")},
+		{name: "json array", input: raw(`["title","Casablanca",12]`)},
+		{name: "missing sort", input: raw(`{"v":"Casablanca","id":12}`)},
+		{name: "wrong id type", input: raw(`{"s":"title","v":"Casablanca","id":"12"}`)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := decodeCursor(tt.input)
+			if !errors.Is(err, errInvalidCursor) {
+				t.Errorf("got error %v; want %v", err, errInvalidCursor)
+			}
+		})
+	}
+}
+
+func TestFiltersCursors(t *testing.T) {
+	f := Filters{Sort: "-year"}
+
+	after, err := decodeCursor(f.cursorAfter("1942", 12))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if want := (cursor{Sort: "-year", Value: "1942", ID: 12}); after != want {
+		t.Errorf("cursorAfter: got %+v; want %+v", after, want)
+	}
+
+	before, err := decodeCursor(f.cursorBefore("1942", 12))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if want := (cursor{Sort: "-year", Value: "1942", ID: 12, Before: true}); before != want {
+		t.Errorf("cursorBefore: got %+v; want %+v", before, want)
+	}
+}
+
+func TestValidateFiltersCursor(t *testing.T) {
+	tests := []struct {
+		name   string
+		sort   string
+		cursor string
+		valid  bool
+	}{
+		{name: "no cursor", sort: "title", cursor: "", valid: true},
+		{name: "matching sort", sort: "title", cursor: encodeCursor(cursor{Sort: "title", Value: "Alien", ID: 1}), valid: true},
+		{name: "matching descending sort", sort: "-title", cursor: encodeCursor(cursor{Sort: "-title", Value: "Alien", ID: 1, Before: true}), valid: true},
+		{name: "different sort", sort: "title", cursor: encodeCursor(cursor{Sort: "year", Value: "1979", ID: 1}), valid: false},
+		{name: "different direction", sort: "title", cursor: encodeCursor(cursor{Sort: "-title", Value: "Alien", ID: 1}), valid: false},
+		{name: "garbage", sort: "title", cursor: "garbage!", valid: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := validator.New()
+
+			ValidateFilters(v, Filters{
+				Page:         1,
+				PageSize:     20,
+				Sort:         tt.sort,
+				SortSafelist: []string{"title", "year", "-title", "-year"},
+				Cursor:       tt.cursor,
+			})
+
+			if v.Valid() != tt.valid {
+				t.Errorf("got valid %t (errors %v); want %t", v.Valid(), v.Errors, tt.valid)
+			}
+
+			if !tt.valid && v.Errors["cursor"] == "" {
+				t.Errorf("got errors %v; want a cursor error", v.Errors)
+			}
+		})
+	}
+}
+
+func TestMovieSortValue(t *testing.T) {
+	movie := &Movie{ID: 42, Title: "Alien", Year: 1979, Runtime: 117, Relevance: 0.25}
+
+	tests := []struct {
+		column string
+		want   string
+	}{
+		{column: "id", want: "42"},
+		{column: "title", want: "Alien"},
+		{column: "year", want: "1979"},
+		{column: "runtime", want: "117"},
+		{column: "relevance", want: "0.25"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.column, func(t *testing.T) {
+			if got := movieSortValue(movie, tt.column); got != tt.want {
+				t.Errorf("got %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,378 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/markponce/greenlight/internal/validator"
+)
+
+// errors specific to franchises
+var (
+	ErrDuplicateFranchise      = errors.New("duplicate franchise")
+	ErrDuplicateFranchiseMovie = errors.New("duplicate franchise movie")
+	ErrInvalidFranchiseOrder   = errors.New("invalid franchise order")
+)
+
+// Franchise is a series of related movies, like the Toy Story films.
+type Franchise struct {
+	ID          int64     `json:"id"`
+	CreatedAt   time.Time `json:"-"`
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	Version     int32     `json:"version"`
+}
+
+// FranchiseMovie is a movie in a franchise. Position is its (1-based) place in the
+// series, which is usually but not always the order the movies were released in:
+// a prequel released later comes earlier in the series.
+type FranchiseMovie struct {
+	Position int    `json:"position"`
+	Movie    *Movie `json:"movie"`
+}
+
+// TotalRuntime adds up the runtimes of the movies in a franchise.
+func TotalRuntime(movies []*FranchiseMovie) Runtime {
+	var total Runtime
+
+	for _, item := range movies {
+		total += item.Movie.Runtime
+	}
+
+	return total
+}
+
+func ValidateFranchise(v *validator.Validator, franchise *Franchise) {
+	v.Check(franchise.Name != "", "name", "must be provided")
+	v.Check(len(franchise.Name) <= 500, "name", "must not be more than 500 bytes long")
+	v.Check(len(franchise.Description) <= 5000, "description", "must not be more than 5000 bytes long")
+}
+
+type FranchiseModel struct {
+	DB *sql.DB
+}
+
+func (m FranchiseModel) Insert(franchise *Franchise) error {
+	query := `
+		INSERT INTO franchises (name, description)
+		VALUES ($1, $2)
+		RETURNING id, created_at, version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, franchise.Name, franchise.Description).Scan(&franchise.ID, &franchise.CreatedAt, &franchise.Version)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "franchises_name_key"`:
+			return ErrDuplicateFranchise
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m FranchiseModel) Get(id int64) (*Franchise, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT id, created_at, name, description, version
+		FROM franchises
+		WHERE id = $1`
+
+	var franchise Franchise
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&franchise.ID,
+		&franchise.CreatedAt,
+		&franchise.Name,
+		&franchise.Description,
+		&franchise.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &franchise, nil
+}
+
+func (m FranchiseModel) Update(franchise *Franchise) error {
+	query := `
+		UPDATE franchises
+		SET name = $1, description = $2, version = version + 1
+		WHERE id = $3 AND version = $4
+		RETURNING version`
+
+	args := []any{
+		franchise.Name,
+		franchise.Description,
+		franchise.ID,
+		franchise.Version,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&franchise.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		case err.Error() == `pq: duplicate key value violates unique constraint "franchises_name_key"`:
+			return ErrDuplicateFranchise
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Delete removes a franchise. The movies in it are left alone.
+func (m FranchiseModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+		DELETE FROM franchises
+		WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (m FranchiseModel) GetAll(name string, filters Filters) ([]*Franchise, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), id, created_at, name, description, version
+		FROM franchises
+		WHERE (to_tsvector('simple', name) @@ plainto_tsquery('simple', $1) OR $1 = '')
+		ORDER BY %s %s, id ASC
+		LIMIT $2 OFFSET $3`,
+		filters.sortColumn(),
+		filters.sortDirection(),
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, name, filters.limit(), filters.offfset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	franchises := []*Franchise{}
+
+	for rows.Next() {
+		var franchise Franchise
+
+		err := rows.Scan(
+			&totalRecords,
+			&franchise.ID,
+			&franchise.CreatedAt,
+			&franchise.Name,
+			&franchise.Description,
+			&franchise.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		franchises = append(franchises, &franchise)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := CalculateMetaData(totalRecords, filters.Page, filters.PageSize, TotalExact)
+
+	return franchises, metadata, nil
+}
+
+// GetMovies returns the movies in a franchise in the order they were released, with
+// their position in the series breaking ties between movies released the same year.
+// Movies in the trash are left out, as are unpublished ones unless includeUnpublished
+// is set.
+func (m FranchiseModel) GetMovies(franchiseID int64, includeUnpublished bool) ([]*FranchiseMovie, error) {
+	query := `
+		SELECT franchises_movies.position,
+			movies.id, movies.created_at, movies.title, movies.year, movies.runtime, movies.genres, movies.version
+		FROM franchises_movies
+		INNER JOIN movies ON movies.id = franchises_movies.movie_id
+		WHERE franchises_movies.franchise_id = $1
+		AND movies.deleted_at IS NULL
+		AND (movies.status = 'published' OR $2)
+		ORDER BY movies.year, franchises_movies.position, movies.id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, franchiseID, includeUnpublished)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []*FranchiseMovie{}
+
+	for rows.Next() {
+		var (
+			item  FranchiseMovie
+			movie Movie
+		)
+
+		err := rows.Scan(
+			&item.Position,
+			&movie.ID,
+			&movie.CreatedAt,
+			&movie.Title,
+			&movie.Year,
+			&movie.Runtime,
+			pq.Array(&movie.Genres),
+			&movie.Vesion,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		item.Movie = &movie
+		items = append(items, &item)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+// AddMovie inserts a movie into a franchise at the given 1-based position, shifting
+// the movies at and after that position along by one. A position of 0 (or one past
+// the end of the series) adds the movie to the end.
+func (m FranchiseModel) AddMovie(franchiseID, movieID int64, position int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Only users who can see unpublished movies can edit franchises, so any movie
+	// can be added.
+	err = insertAtPosition(ctx, tx, "franchises", "franchises_movies", "franchise_id", franchiseID, movieID, position, true)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "franchises_movies_pkey"`:
+			return ErrDuplicateFranchiseMovie
+		default:
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// RemoveMovie removes a movie from a franchise and closes the gap it leaves behind.
+func (m FranchiseModel) RemoveMovie(franchiseID, movieID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var position int
+
+	err = tx.QueryRowContext(ctx, `
+		DELETE FROM franchises_movies
+		WHERE franchise_id = $1 AND movie_id = $2
+		RETURNING position`, franchiseID, movieID).Scan(&position)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE franchises_movies
+		SET position = position - 1
+		WHERE franchise_id = $1 AND position > $2`, franchiseID, position)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Reorder sets the series order of the movies in a franchise to the order of
+// movieIDs, which must contain every movie in the franchise exactly once. As in
+// GetMovies(), movies in the trash, and unpublished ones unless includeUnpublished is
+// set, aren't given, and are moved after the rest, in the order they were in.
+func (m FranchiseModel) Reorder(franchiseID int64, movieIDs []int64, includeUnpublished bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `SELECT id FROM franchises WHERE id = $1 FOR UPDATE`, franchiseID)
+	if err != nil {
+		return err
+	}
+
+	ok, err := reorderPositions(ctx, tx, "franchises_movies", "franchise_id", franchiseID, movieIDs, includeUnpublished)
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		return ErrInvalidFranchiseOrder
+	}
+
+	return tx.Commit()
+}
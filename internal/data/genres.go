@@ -0,0 +1,427 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/markponce/greenlight/internal/validator"
+)
+
+// errors specific to genres
+var (
+	ErrDuplicateGenre = errors.New("duplicate genre")
+	ErrGenreInUse     = errors.New("genre in use")
+	ErrUnknownGenre   = errors.New("unknown genre")
+)
+
+// SlugRX matches genre slugs, which are made up of lowercase letters and digits
+// separated by single hyphens, like "science-fiction".
+var SlugRX = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// Genre is an entry in the genre taxonomy. Movies are tagged with the slug, while
+// the aliases are other spellings which are accepted in its place.
+type Genre struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"-"`
+	Slug      string    `json:"slug"`
+	Name      string    `json:"name"`
+	Aliases   []string  `json:"aliases"`
+	Version   int32     `json:"version"`
+}
+
+// ValidateGenre checks a genre before it's saved. Aliases are matched regardless of
+// case, so they're also lowercased here.
+func ValidateGenre(v *validator.Validator, genre *Genre) {
+	for i, alias := range genre.Aliases {
+		genre.Aliases[i] = strings.ToLower(strings.TrimSpace(alias))
+	}
+
+	v.Check(genre.Slug != "", "slug", "must be provided")
+	v.Check(len(genre.Slug) <= 100, "slug", "must not be more than 100 bytes long")
+	v.Check(validator.Matches(genre.Slug, SlugRX), "slug", "must only contain lowercase letters, digits and single hyphens")
+
+	v.Check(genre.Name != "", "name", "must be provided")
+	v.Check(len(genre.Name) <= 100, "name", "must not be more than 100 bytes long")
+
+	v.Check(len(genre.Aliases) <= 20, "aliases", "must not contain more than 20 aliases")
+	v.Check(validator.Unique(genre.Aliases), "aliases", "must not contain duplicate values")
+
+	for _, alias := range genre.Aliases {
+		v.Check(alias != "", "aliases", "must not contain empty values")
+		v.Check(len(alias) <= 100, "aliases", "must not contain values more than 100 bytes long")
+		v.Check(alias != genre.Slug, "aliases", "must not contain the slug")
+	}
+}
+
+// Slugify reduces a genre name to the slug form, so "Sci Fi" becomes "sci-fi".
+func Slugify(s string) string {
+	words := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !('a' <= r && r <= 'z') && !('0' <= r && r <= '9')
+	})
+
+	return strings.Join(words, "-")
+}
+
+// Taxonomy maps every slug and alias in the genres table to its canonical slug. The
+// keys are lowercase.
+type Taxonomy map[string]string
+
+// Canonical returns the slug for a genre name, which can be a slug or an alias in
+// any case, or a name which reduces to one of them.
+func (t Taxonomy) Canonical(name string) (string, bool) {
+	if slug, ok := t[strings.ToLower(strings.TrimSpace(name))]; ok {
+		return slug, true
+	}
+
+	slug, ok := t[Slugify(name)]
+	return slug, ok
+}
+
+type GenreModel struct {
+	DB *sql.DB
+}
+
+// Taxonomy loads the whole genre taxonomy, for use with ValidateMovie().
+func (m GenreModel) Taxonomy() (Taxonomy, error) {
+	query := `
+		SELECT slug, aliases
+		FROM genres`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	taxonomy := make(Taxonomy)
+
+	for rows.Next() {
+		var (
+			slug    string
+			aliases []string
+		)
+
+		err := rows.Scan(&slug, pq.Array(&aliases))
+		if err != nil {
+			return nil, err
+		}
+
+		taxonomy[slug] = slug
+		for _, alias := range aliases {
+			taxonomy[strings.ToLower(alias)] = slug
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return taxonomy, nil
+}
+
+// checkNames returns ErrDuplicateGenre if any genre other than the one given already
+// uses the slug or one of the aliases, as either its slug or an alias. A unique
+// constraint covers slugs, but not aliases, which live in an array. Like the
+// taxonomy, the comparison ignores the case of aliases.
+func (m GenreModel) checkNames(ctx context.Context, genre *Genre) error {
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM genres
+			WHERE id <> $1
+			AND (slug = ANY($2) OR EXISTS (
+				SELECT 1 FROM unnest(aliases) AS alias WHERE lower(alias) = ANY($2)
+			))
+		)`
+
+	names := append([]string{genre.Slug}, genre.Aliases...)
+
+	var exists bool
+
+	err := m.DB.QueryRowContext(ctx, query, genre.ID, pq.Array(names)).Scan(&exists)
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		return ErrDuplicateGenre
+	}
+
+	return nil
+}
+
+func (m GenreModel) Insert(genre *Genre) error {
+	query := `
+		INSERT INTO genres (slug, name, aliases)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at, version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.checkNames(ctx, genre)
+	if err != nil {
+		return err
+	}
+
+	err = m.DB.QueryRowContext(ctx, query, genre.Slug, genre.Name, pq.Array(genre.Aliases)).Scan(&genre.ID, &genre.CreatedAt, &genre.Version)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "genres_slug_key"`:
+			return ErrDuplicateGenre
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m GenreModel) Get(id int64) (*Genre, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT id, created_at, slug, name, aliases, version
+		FROM genres
+		WHERE id = $1`
+
+	var genre Genre
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&genre.ID,
+		&genre.CreatedAt,
+		&genre.Slug,
+		&genre.Name,
+		pq.Array(&genre.Aliases),
+		&genre.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &genre, nil
+}
+
+// Update saves changes to a genre's name and aliases. The slug can't be changed,
+// since movies are tagged with it.
+func (m GenreModel) Update(genre *Genre) error {
+	query := `
+		UPDATE genres
+		SET name = $1, aliases = $2, version = version + 1
+		WHERE id = $3 AND version = $4
+		RETURNING version`
+
+	args := []any{
+		genre.Name,
+		pq.Array(genre.Aliases),
+		genre.ID,
+		genre.Version,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.checkNames(ctx, genre)
+	if err != nil {
+		return err
+	}
+
+	err = m.DB.QueryRowContext(ctx, query, args...).Scan(&genre.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Delete removes a genre from the taxonomy. If any movies are tagged with it,
+// replacement must name another genre to merge it into: the movies are retagged
+// with the replacement, recording a revision of each against the given user, and the
+// deleted genre's slug and aliases become aliases of the replacement. Without a
+// replacement, deleting a genre which is in use returns ErrGenreInUse.
+func (m GenreModel) Delete(id int64, replacement string, userID int64) error {
+	genre, err := m.Get(id)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if replacement == "" {
+		var inUse bool
+
+		err = tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM movies WHERE genres @> ARRAY[$1::text])`, genre.Slug).Scan(&inUse)
+		if err != nil {
+			return err
+		}
+
+		if inUse {
+			return ErrGenreInUse
+		}
+	} else {
+		// Fold the genre's names into the replacement's aliases.
+		query := `
+			UPDATE genres
+			SET aliases = ARRAY(SELECT DISTINCT unnest(aliases || $1::text[])), version = version + 1
+			WHERE slug = $2 AND id <> $3`
+
+		names := append([]string{genre.Slug}, genre.Aliases...)
+
+		result, err := tx.ExecContext(ctx, query, pq.Array(names), replacement, genre.ID)
+		if err != nil {
+			return err
+		}
+
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if rowsAffected == 0 {
+			return ErrUnknownGenre
+		}
+
+		// Retag the movies, keeping the order of their genres and dropping the
+		// duplicate if a movie already had the replacement.
+		query = `
+			WITH updated AS (
+				UPDATE movies
+				SET genres = ARRAY(
+					SELECT genre
+					FROM unnest(array_replace(movies.genres, $1, $2)) WITH ORDINALITY AS g (genre, ord)
+					GROUP BY genre
+					ORDER BY min(ord)
+				),
+				version = version + 1
+				WHERE genres @> ARRAY[$1::text]
+				RETURNING id, version, title, year, runtime, genres
+			)
+			INSERT INTO movie_revisions (movie_id, version, operation, user_id, title, year, runtime, genres)
+			SELECT id, version, 'update', NULLIF($3::bigint, 0), title, year, runtime, genres
+			FROM updated`
+
+		_, err = tx.ExecContext(ctx, query, genre.Slug, replacement, userID)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM genres WHERE id = $1`, genre.ID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetAll returns the whole taxonomy, in slug order. There are few enough genres that
+// it isn't paginated.
+func (m GenreModel) GetAll() ([]*Genre, error) {
+	query := `
+		SELECT id, created_at, slug, name, aliases, version
+		FROM genres
+		ORDER BY slug ASC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	genres := []*Genre{}
+
+	for rows.Next() {
+		var genre Genre
+
+		err := rows.Scan(
+			&genre.ID,
+			&genre.CreatedAt,
+			&genre.Slug,
+			&genre.Name,
+			pq.Array(&genre.Aliases),
+			&genre.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		genres = append(genres, &genre)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return genres, nil
+}
+
+// canonicalGenres maps each of a movie's genres to its slug, returning the names
+// which aren't in the taxonomy.
+func canonicalGenres(taxonomy Taxonomy, genres []string) ([]string, []string) {
+	var unknown []string
+
+	canonical := make([]string, len(genres))
+
+	for i, name := range genres {
+		slug, ok := taxonomy.Canonical(name)
+		if !ok {
+			unknown = append(unknown, name)
+			slug = name
+		}
+		canonical[i] = slug
+	}
+
+	return canonical, unknown
+}
+
+// CanonicalGenreFilter maps the genres given to filter movies by onto their slugs,
+// the same way ValidateMovie() does for a movie's own genres, so that names and
+// aliases match the slugs movies are stored with. Genres missing from the taxonomy
+// are reported against key, as they could never match anything.
+func CanonicalGenreFilter(v *validator.Validator, key string, genres []string, taxonomy Taxonomy) []string {
+	canonical, unknown := canonicalGenres(taxonomy, genres)
+	if len(unknown) > 0 {
+		v.AddError(key, unknownGenresMessage(unknown))
+	}
+
+	return canonical
+}
+
+// unknownGenresMessage builds the validation message for genres missing from the
+// taxonomy.
+func unknownGenresMessage(unknown []string) string {
+	return fmt.Sprintf("must only contain known genres (unknown: %s)", strings.Join(unknown, ", "))
+}
@@ -0,0 +1,241 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/markponce/greenlight/internal/validator"
+)
+
+// Kinds of movie image.
+const (
+	ImagePoster = "poster"
+	ImageStill  = "still"
+)
+
+// ThumbnailWidths holds the width in pixels of each thumbnail size generated for a
+// movie image.
+var ThumbnailWidths = map[string]int{
+	"small":  160,
+	"medium": 320,
+	"large":  640,
+}
+
+// MovieImage is a poster or still attached to a movie. The files themselves are kept
+// in storage under Key, with each thumbnail alongside it; URL and Thumbnails are
+// filled in from the storage before the image is sent to a client.
+type MovieImage struct {
+	ID          int64             `json:"id"`
+	MovieID     int64             `json:"-"`
+	CreatedAt   time.Time         `json:"-"`
+	Kind        string            `json:"kind"`
+	Key         string            `json:"-"`
+	ContentType string            `json:"content_type"`
+	Width       int               `json:"width"`
+	Height      int               `json:"height"`
+	Size        int64             `json:"size"`
+	URL         string            `json:"url,omitempty"`
+	Thumbnails  map[string]string `json:"thumbnails,omitempty"`
+}
+
+// ThumbnailKey returns the storage key for one of the image's thumbnails, which is
+// the image's own key with the size added and a .jpg extension.
+func (img *MovieImage) ThumbnailKey(size string) string {
+	base := img.Key
+	if i := strings.LastIndex(base, "."); i > strings.LastIndex(base, "/") {
+		base = base[:i]
+	}
+
+	return base + "_" + size + ".jpg"
+}
+
+// Keys returns the storage keys of the image and all of its thumbnails.
+func (img *MovieImage) Keys() []string {
+	keys := []string{img.Key}
+
+	for size := range ThumbnailWidths {
+		keys = append(keys, img.ThumbnailKey(size))
+	}
+
+	return keys
+}
+
+func ValidateMovieImage(v *validator.Validator, img *MovieImage) {
+	v.Check(validator.PermittedValue(img.Kind, ImagePoster, ImageStill), "kind", "must be either poster or still")
+}
+
+type ImageModel struct {
+	DB *sql.DB
+}
+
+// Insert records a new image of a movie. Since the images are part of the movie's
+// representation, the movie's version is incremented too, recording a revision
+// against the given user, so that cached copies and ETags are invalidated.
+func (m ImageModel) Insert(img *MovieImage, userID int64) error {
+	query := `
+		INSERT INTO movie_images (movie_id, kind, storage_key, content_type, width, height, size)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at`
+
+	args := []any{
+		img.MovieID,
+		img.Kind,
+		img.Key,
+		img.ContentType,
+		img.Width,
+		img.Height,
+		img.Size,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = bumpMovieVersion(ctx, tx, img.MovieID, userID)
+	if err != nil {
+		return err
+	}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&img.ID, &img.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Delete removes an image from a movie, incrementing the movie's version as Insert()
+// does. It returns the deleted image, so that its files can be removed from storage.
+func (m ImageModel) Delete(movieID, id int64, userID int64) (*MovieImage, error) {
+	query := `
+		DELETE FROM movie_images
+		WHERE id = $1 AND movie_id = $2
+		RETURNING id, movie_id, created_at, kind, storage_key, content_type, width, height, size`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var img MovieImage
+
+	err = tx.QueryRowContext(ctx, query, id, movieID).Scan(
+		&img.ID,
+		&img.MovieID,
+		&img.CreatedAt,
+		&img.Kind,
+		&img.Key,
+		&img.ContentType,
+		&img.Width,
+		&img.Height,
+		&img.Size,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	err = bumpMovieVersion(ctx, tx, movieID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &img, tx.Commit()
+}
+
+// GetForMovies returns the images of each of the given movies, keyed by movie ID,
+// with posters first and then in upload order.
+func (m ImageModel) GetForMovies(movieIDs []int64) (map[int64][]*MovieImage, error) {
+	query := `
+		SELECT id, movie_id, created_at, kind, storage_key, content_type, width, height, size
+		FROM movie_images
+		WHERE movie_id = ANY($1)
+		ORDER BY movie_id, kind = 'poster' DESC, id ASC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(movieIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	images := make(map[int64][]*MovieImage)
+
+	for rows.Next() {
+		var img MovieImage
+
+		err := rows.Scan(
+			&img.ID,
+			&img.MovieID,
+			&img.CreatedAt,
+			&img.Kind,
+			&img.Key,
+			&img.ContentType,
+			&img.Width,
+			&img.Height,
+			&img.Size,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		images[img.MovieID] = append(images[img.MovieID], &img)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return images, nil
+}
+
+// bumpMovieVersion increments the version of a movie whose images or translations
+// have changed and records the new revision. It returns ErrRecordNotFound if the
+// movie doesn't exist or is in the trash.
+func bumpMovieVersion(ctx context.Context, tx *sql.Tx, movieID int64, userID int64) error {
+	query := `
+		UPDATE movies
+		SET version = version + 1
+		WHERE id = $1 AND deleted_at IS NULL
+		RETURNING id, title, year, runtime, genres, version`
+
+	var movie Movie
+
+	err := tx.QueryRowContext(ctx, query, movieID).Scan(
+		&movie.ID,
+		&movie.Title,
+		&movie.Year,
+		&movie.Runtime,
+		pq.Array(&movie.Genres),
+		&movie.Vesion,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	return insertRevision(ctx, tx, &movie, RevisionUpdate, userID)
+}
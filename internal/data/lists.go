@@ -0,0 +1,522 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/markponce/greenlight/internal/validator"
+)
+
+// errors specific to lists
+var (
+	ErrDuplicateListMovie = errors.New("duplicate list movie")
+	ErrInvalidListOrder   = errors.New("invalid list order")
+)
+
+// List is a named, ordered collection of movies curated by a user. Private lists
+// are only visible to their owner.
+type List struct {
+	ID          int64     `json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	UserID      int64     `json:"owner_id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	Public      bool      `json:"public"`
+	Version     int32     `json:"version"`
+}
+
+// ListMovie is a movie at a given (1-based) position in a list.
+type ListMovie struct {
+	Position int       `json:"position"`
+	AddedAt  time.Time `json:"added_at"`
+	Movie    *Movie    `json:"movie"`
+}
+
+// VisibleTo reports whether the given user is allowed to see the list.
+func (l *List) VisibleTo(user *User) bool {
+	return l.Public || l.UserID == user.ID
+}
+
+func ValidateList(v *validator.Validator, list *List) {
+	v.Check(list.Name != "", "name", "must be provided")
+	v.Check(len(list.Name) <= 500, "name", "must not be more than 500 bytes long")
+	v.Check(len(list.Description) <= 5000, "description", "must not be more than 5000 bytes long")
+}
+
+type ListModel struct {
+	DB *sql.DB
+}
+
+func (m ListModel) Insert(list *List) error {
+	query := `
+		INSERT INTO lists (user_id, name, description, public)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at, version`
+
+	args := []any{
+		list.UserID,
+		list.Name,
+		list.Description,
+		list.Public,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&list.ID, &list.CreatedAt, &list.Version)
+}
+
+func (m ListModel) Get(id int64) (*List, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT id, created_at, user_id, name, description, public, version
+		FROM lists
+		WHERE id = $1`
+
+	var list List
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&list.ID,
+		&list.CreatedAt,
+		&list.UserID,
+		&list.Name,
+		&list.Description,
+		&list.Public,
+		&list.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &list, nil
+}
+
+func (m ListModel) Update(list *List) error {
+	query := `
+		UPDATE lists
+		SET name = $1, description = $2, public = $3, version = version + 1
+		WHERE id = $4 AND version = $5
+		RETURNING version`
+
+	args := []any{
+		list.Name,
+		list.Description,
+		list.Public,
+		list.ID,
+		list.Version,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&list.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m ListModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+		DELETE FROM lists
+		WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// GetAll returns the lists visible to the viewer: every public list, plus the
+// viewer's own private ones. An ownerID of 0 returns lists from all owners.
+func (m ListModel) GetAll(viewerID, ownerID int64, name string, filters Filters) ([]*List, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), id, created_at, user_id, name, description, public, version
+		FROM lists
+		WHERE (public OR user_id = $1)
+		AND (user_id = $2 OR $2 = 0)
+		AND (to_tsvector('simple', name) @@ plainto_tsquery('simple', $3) OR $3 = '')
+		ORDER BY %s %s, id ASC
+		LIMIT $4 OFFSET $5`,
+		filters.sortColumn(),
+		filters.sortDirection(),
+	)
+
+	args := []any{
+		viewerID,
+		ownerID,
+		name,
+		filters.limit(),
+		filters.offfset(),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	lists := []*List{}
+
+	for rows.Next() {
+		var list List
+
+		err := rows.Scan(
+			&totalRecords,
+			&list.ID,
+			&list.CreatedAt,
+			&list.UserID,
+			&list.Name,
+			&list.Description,
+			&list.Public,
+			&list.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		lists = append(lists, &list)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := CalculateMetaData(totalRecords, filters.Page, filters.PageSize, TotalExact)
+
+	return lists, metadata, nil
+}
+
+// GetMovies returns the movies in a list, in list order. Movies in the trash keep
+// their place in the list, but are left out, as are unpublished ones unless
+// includeUnpublished is set.
+func (m ListModel) GetMovies(listID int64, includeUnpublished bool) ([]*ListMovie, error) {
+	query := `
+		SELECT lists_movies.position, lists_movies.added_at,
+			movies.id, movies.created_at, movies.title, movies.year, movies.runtime, movies.genres, movies.version
+		FROM lists_movies
+		INNER JOIN movies ON movies.id = lists_movies.movie_id
+		WHERE lists_movies.list_id = $1
+		AND movies.deleted_at IS NULL
+		AND (movies.status = 'published' OR $2)
+		ORDER BY lists_movies.position, movies.id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, listID, includeUnpublished)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []*ListMovie{}
+
+	for rows.Next() {
+		var (
+			item  ListMovie
+			movie Movie
+		)
+
+		err := rows.Scan(
+			&item.Position,
+			&item.AddedAt,
+			&movie.ID,
+			&movie.CreatedAt,
+			&movie.Title,
+			&movie.Year,
+			&movie.Runtime,
+			pq.Array(&movie.Genres),
+			&movie.Vesion,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		item.Movie = &movie
+		items = append(items, &item)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+// AddMovie inserts a movie into a list at the given 1-based position, shifting the
+// movies at and after that position down by one. A position of 0 (or one past the
+// end of the list) appends the movie. Unpublished movies can only be added when
+// includeUnpublished is set.
+func (m ListModel) AddMovie(listID, movieID int64, position int, includeUnpublished bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = insertAtPosition(ctx, tx, "lists", "lists_movies", "list_id", listID, movieID, position, includeUnpublished)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "lists_movies_pkey"`:
+			return ErrDuplicateListMovie
+		default:
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// insertAtPosition adds a movie to an ordered collection of movies, such as a list, at
+// the given 1-based position, shifting the movies at and after that position along by
+// one. A position of 0 (or one past the end) adds the movie to the end. The parent
+// table holds the collections, and the table holds their movies, referring to the
+// parent through column. It returns ErrRecordNotFound if the parent doesn't exist, or
+// if the movie doesn't exist, is in the trash, or is unpublished and
+// includeUnpublished isn't set.
+func insertAtPosition(ctx context.Context, tx *sql.Tx, parent, table, column string, parentID, movieID int64, position int, includeUnpublished bool) error {
+	// Lock the parent row so that concurrent changes to the same collection can't
+	// end up with two movies at the same position.
+	var id int64
+
+	err := tx.QueryRowContext(ctx, fmt.Sprintf(`SELECT id FROM %s WHERE id = $1 FOR UPDATE`, parent), parentID).Scan(&id)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	var count int
+
+	err = tx.QueryRowContext(ctx, fmt.Sprintf(`SELECT count(*) FROM %s WHERE %s = $1`, table, column), parentID).Scan(&count)
+	if err != nil {
+		return err
+	}
+
+	if position < 1 || position > count {
+		position = count + 1
+	}
+
+	_, err = tx.ExecContext(ctx, fmt.Sprintf(`
+		UPDATE %[1]s
+		SET position = position + 1
+		WHERE %[2]s = $1 AND position >= $2`, table, column), parentID, position)
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.ExecContext(ctx, fmt.Sprintf(`
+		INSERT INTO %s (%s, movie_id, position)
+		SELECT $1, id, $3 FROM movies
+		WHERE id = $2 AND deleted_at IS NULL AND (status = 'published' OR $4)`, table, column), parentID, movieID, position, includeUnpublished)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// RemoveMovie removes a movie from a list and closes the gap it leaves behind.
+func (m ListModel) RemoveMovie(listID, movieID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var position int
+
+	err = tx.QueryRowContext(ctx, `
+		DELETE FROM lists_movies
+		WHERE list_id = $1 AND movie_id = $2
+		RETURNING position`, listID, movieID).Scan(&position)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE lists_movies
+		SET position = position - 1
+		WHERE list_id = $1 AND position > $2`, listID, position)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Reorder rearranges the movies in a list to match the order of movieIDs, which
+// must contain every movie in the list exactly once. Movies in the trash, and
+// unpublished ones unless includeUnpublished is set, aren't given, and are moved
+// after the rest, in the order they were in.
+func (m ListModel) Reorder(listID int64, movieIDs []int64, includeUnpublished bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `SELECT id FROM lists WHERE id = $1 FOR UPDATE`, listID)
+	if err != nil {
+		return err
+	}
+
+	ok, err := reorderPositions(ctx, tx, "lists_movies", "list_id", listID, movieIDs, includeUnpublished)
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		return ErrInvalidListOrder
+	}
+
+	return tx.Commit()
+}
+
+// reorderPositions renumbers the movies in an ordered collection of movies, such as a
+// list, to match the order of movieIDs. The table holds the collection's movies,
+// referring to it through column, and the parent row must already be locked.
+// movieIDs must be exactly the movies in the collection that the caller can see:
+// those which aren't in the trash, and are published unless includeUnpublished is
+// set. If it isn't, nothing is changed and false is returned. The hidden movies are
+// moved after the rest, in the order they were in.
+func reorderPositions(ctx context.Context, tx *sql.Tx, table, column string, parentID int64, movieIDs []int64, includeUnpublished bool) (bool, error) {
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf(`
+		SELECT %[1]s.movie_id
+		FROM %[1]s
+		INNER JOIN movies ON movies.id = %[1]s.movie_id
+		WHERE %[1]s.%[2]s = $1 AND movies.deleted_at IS NULL
+		AND (movies.status = 'published' OR $2)`, table, column), parentID, includeUnpublished)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	visible := make(map[int64]bool)
+
+	for rows.Next() {
+		var id int64
+
+		err := rows.Scan(&id)
+		if err != nil {
+			return false, err
+		}
+
+		visible[id] = false
+	}
+
+	if err = rows.Err(); err != nil {
+		return false, err
+	}
+
+	// Every given movie must be a visible one, given only once, and every visible
+	// movie must be given.
+	if len(movieIDs) != len(visible) {
+		return false, nil
+	}
+
+	for _, id := range movieIDs {
+		seen, ok := visible[id]
+		if !ok || seen {
+			return false, nil
+		}
+
+		visible[id] = true
+	}
+
+	_, err = tx.ExecContext(ctx, fmt.Sprintf(`
+		UPDATE %[1]s
+		SET position = ordered.position
+		FROM unnest($2::bigint[]) WITH ORDINALITY AS ordered(movie_id, position)
+		WHERE %[1]s.%[2]s = $1 AND %[1]s.movie_id = ordered.movie_id`, table, column), parentID, pq.Array(movieIDs))
+	if err != nil {
+		return false, err
+	}
+
+	_, err = tx.ExecContext(ctx, fmt.Sprintf(`
+		UPDATE %[1]s
+		SET position = $2 + hidden.n
+		FROM (
+			SELECT %[1]s.movie_id, row_number() OVER (ORDER BY %[1]s.position, %[1]s.movie_id) AS n
+			FROM %[1]s
+			INNER JOIN movies ON movies.id = %[1]s.movie_id
+			WHERE %[1]s.%[2]s = $1
+			AND (movies.deleted_at IS NOT NULL OR (movies.status <> 'published' AND NOT $3))
+		) AS hidden
+		WHERE %[1]s.%[2]s = $1 AND %[1]s.movie_id = hidden.movie_id`, table, column), parentID, len(movieIDs), includeUnpublished)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
@@ -0,0 +1,495 @@
+package data
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// DuplicateSimilarity is the default for how similar two movies' normalized titles
+// must be, as measured by trigram similarity, for them to be suggested as duplicates.
+const DuplicateSimilarity = 0.6
+
+// DuplicateGroup is a set of movies which look like duplicates of each other. Every
+// movie is in the same year, and is similar to at least one of the others in the
+// group. Similarity is that of the most similar pair.
+type DuplicateGroup struct {
+	Similarity float64  `json:"similarity"`
+	Movies     []*Movie `json:"movies"`
+
+	ids []int64
+}
+
+// MovieMerge is an entry in the audit log of merges. Duplicate is the movie as it was
+// just before it was merged into the survivor, and Moved counts the references to it
+// which were moved to the survivor, by kind.
+type MovieMerge struct {
+	ID         int64            `json:"id"`
+	CreatedAt  time.Time        `json:"created_at"`
+	UserID     int64            `json:"user_id,omitzero"`
+	SurvivorID int64            `json:"survivor_id"`
+	Duplicate  *Movie           `json:"duplicate"`
+	Moved      map[string]int64 `json:"moved"`
+}
+
+// movieReferences lists the tables which refer to movies and are moved to the
+// survivor in a merge, along with the columns which, together with movie_id, must be
+// unique. Where the survivor already has a matching row, the duplicate's is dropped.
+var movieReferences = []struct {
+	name   string
+	table  string
+	unique []string
+}{
+	{"credits", "movies_people", []string{"person_id", "role", "character_name"}},
+	{"watchlist", "watchlist", []string{"user_id"}},
+	{"lists", "lists_movies", []string{"list_id"}},
+	{"franchises", "franchises_movies", []string{"franchise_id"}},
+	{"images", "movie_images", nil},
+	{"translations", "movie_translations", []string{"locale"}},
+	{"releases", "movie_releases", []string{"country"}},
+	{"submissions", "movie_submissions", nil},
+}
+
+// normalizedTitle returns the SQL for the title of the movie with the given alias in
+// lowercase, with runs of punctuation and spaces replaced by a single space. It must
+// match the expression of the movies_normalized_title_trgm_idx index exactly for the
+// index to be used.
+func normalizedTitle(alias string) string {
+	return fmt.Sprintf(`trim(regexp_replace(lower(%s.title), '[^[:alnum:]]+', ' ', 'g'))`, alias)
+}
+
+type MergeModel struct {
+	DB *sql.DB
+}
+
+// FindDuplicates returns groups of movies which are likely to be duplicates: movies
+// released in the same year, sharing at least one genre (or both having none), with
+// titles at least minSimilarity similar once case and punctuation are ignored. The
+// groups are ordered from the most similar down.
+func (m MergeModel) FindDuplicates(minSimilarity float64, filters Filters) ([]*DuplicateGroup, Metadata, error) {
+	// The % operator matches titles at least as similar as the similarity_threshold
+	// setting, and can use the trigram index on the normalized title, so that each
+	// movie is only compared with the handful of movies whose titles look like it.
+	query := fmt.Sprintf(`
+		SELECT a.id, b.id, similarity(%[1]s, %[2]s)
+		FROM movies AS a
+		INNER JOIN movies AS b ON %[2]s %% %[1]s
+		WHERE b.year = a.year AND b.id > a.id
+		AND a.deleted_at IS NULL AND b.deleted_at IS NULL
+		AND (a.genres && b.genres OR (a.genres = '{}' AND b.genres = '{}'))
+		AND similarity(%[1]s, %[2]s) >= $1`, normalizedTitle("a"), normalizedTitle("b"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	// The threshold is set for this transaction only, as the connection goes back to
+	// the pool afterwards.
+	tx, err := m.DB.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `SELECT set_config('pg_trgm.similarity_threshold', $1, true)`, strconv.FormatFloat(minSimilarity, 'g', -1, 64))
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	rows, err := tx.QueryContext(ctx, query, minSimilarity)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	// Pairs are joined up into groups with a union-find, so that if A looks like B
+	// and B looks like C, all three end up in one group.
+	parent := make(map[int64]int64)
+
+	var find func(id int64) int64
+	find = func(id int64) int64 {
+		if p, ok := parent[id]; ok && p != id {
+			parent[id] = find(p)
+			return parent[id]
+		}
+		parent[id] = id
+		return id
+	}
+
+	best := make(map[int64]float64)
+
+	for rows.Next() {
+		var (
+			a, b       int64
+			similarity float64
+		)
+
+		err := rows.Scan(&a, &b, &similarity)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		parent[find(b)] = find(a)
+		best[a] = max(best[a], similarity)
+		best[b] = max(best[b], similarity)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	byRoot := make(map[int64]*DuplicateGroup)
+
+	for id := range parent {
+		root := find(id)
+
+		group, ok := byRoot[root]
+		if !ok {
+			group = &DuplicateGroup{}
+			byRoot[root] = group
+		}
+
+		group.ids = append(group.ids, id)
+		group.Similarity = max(group.Similarity, best[id])
+	}
+
+	groups := slices.Collect(maps.Values(byRoot))
+
+	for _, group := range groups {
+		slices.Sort(group.ids)
+	}
+
+	// Order by similarity, with the group holding the oldest movie first on ties, so
+	// that pages are stable.
+	slices.SortFunc(groups, func(a, b *DuplicateGroup) int {
+		if c := cmp.Compare(b.Similarity, a.Similarity); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.ids[0], b.ids[0])
+	})
+
+	metadata := CalculateMetaData(len(groups), filters.Page, filters.PageSize, TotalExact)
+
+	start := min(filters.offfset(), len(groups))
+	end := min(start+filters.limit(), len(groups))
+	groups = groups[start:end]
+
+	// Only the movies on this page need to be loaded.
+	var ids []int64
+	for _, group := range groups {
+		ids = append(ids, group.ids...)
+	}
+
+	movies, err := m.getMovies(ctx, ids)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	for _, group := range groups {
+		for _, id := range group.ids {
+			if movie, ok := movies[id]; ok {
+				group.Movies = append(group.Movies, movie)
+			}
+		}
+	}
+
+	return groups, metadata, nil
+}
+
+// getMovies loads the given movies, keyed by ID.
+func (m MergeModel) getMovies(ctx context.Context, ids []int64) (map[int64]*Movie, error) {
+	query := `
+		SELECT id, created_at, title, year, runtime, genres, version
+		FROM movies
+		WHERE id = ANY($1)`
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	movies := make(map[int64]*Movie, len(ids))
+
+	for rows.Next() {
+		var movie Movie
+
+		err := rows.Scan(
+			&movie.ID,
+			&movie.CreatedAt,
+			&movie.Title,
+			&movie.Year,
+			&movie.Runtime,
+			pq.Array(&movie.Genres),
+			&movie.Vesion,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		movies[movie.ID] = &movie
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return movies, nil
+}
+
+// Merge merges the duplicate movie into the survivor. Everything which refers to the
+// duplicate is moved over to the survivor, except where the survivor already has the
+// equivalent (such as a translation into the same locale), then the duplicate is
+// deleted outright and the merge recorded in the audit log. It all happens in one
+// transaction, so a merge either completes or leaves both movies untouched. It
+// returns ErrRecordNotFound if either movie doesn't exist or is in the trash.
+func (m MergeModel) Merge(survivorID, duplicateID, userID int64) (*MovieMerge, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Lock both movies, in ID order so that two merges of the same pair can't
+	// deadlock.
+	rows, err := tx.QueryContext(ctx, `
+		SELECT id, created_at, title, year, runtime, genres, version
+		FROM movies
+		WHERE id = ANY($1) AND deleted_at IS NULL
+		ORDER BY id
+		FOR UPDATE`, pq.Array([]int64{survivorID, duplicateID}))
+	if err != nil {
+		return nil, err
+	}
+
+	var duplicate *Movie
+	found := 0
+
+	for rows.Next() {
+		var movie Movie
+
+		err := rows.Scan(
+			&movie.ID,
+			&movie.CreatedAt,
+			&movie.Title,
+			&movie.Year,
+			&movie.Runtime,
+			pq.Array(&movie.Genres),
+			&movie.Vesion,
+		)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+
+		if movie.ID == duplicateID {
+			duplicate = &movie
+		}
+		found++
+	}
+	rows.Close()
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if found != 2 {
+		return nil, ErrRecordNotFound
+	}
+
+	merge := &MovieMerge{
+		UserID:     userID,
+		SurvivorID: survivorID,
+		Duplicate:  duplicate,
+		Moved:      make(map[string]int64),
+	}
+
+	// Watchlist entries which both movies have are combined, rather than just
+	// dropping the duplicate's, so that nobody loses a favorite or watched mark.
+	_, err = tx.ExecContext(ctx, `
+		UPDATE watchlist AS kept
+		SET favorite = kept.favorite OR dropped.favorite,
+			watched_at = COALESCE(kept.watched_at, dropped.watched_at),
+			added_at = LEAST(kept.added_at, dropped.added_at)
+		FROM watchlist AS dropped
+		WHERE kept.movie_id = $1 AND dropped.movie_id = $2 AND dropped.user_id = kept.user_id`, survivorID, duplicateID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, ref := range movieReferences {
+		query := fmt.Sprintf(`UPDATE %s SET movie_id = $1 WHERE movie_id = $2`, ref.table)
+
+		if len(ref.unique) > 0 {
+			conditions := make([]string, len(ref.unique))
+			for i, column := range ref.unique {
+				conditions[i] = fmt.Sprintf("kept.%[2]s = %[1]s.%[2]s", ref.table, column)
+			}
+
+			query += fmt.Sprintf(` AND NOT EXISTS (
+				SELECT 1 FROM %s AS kept WHERE kept.movie_id = $1 AND %s
+			)`, ref.table, strings.Join(conditions, " AND "))
+		}
+
+		result, err := tx.ExecContext(ctx, query, survivorID, duplicateID)
+		if err != nil {
+			return nil, err
+		}
+
+		moved, err := result.RowsAffected()
+		if err != nil {
+			return nil, err
+		}
+
+		merge.Moved[ref.name] = moved
+	}
+
+	// Whatever is left pointing at the duplicate goes with it.
+	_, err = tx.ExecContext(ctx, `DELETE FROM movies WHERE id = $1`, duplicateID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Lists and franchises which had both movies are now a movie short, so close up
+	// the gaps in their positions.
+	for _, ordered := range []struct{ table, group string }{
+		{"lists_movies", "list_id"},
+		{"franchises_movies", "franchise_id"},
+	} {
+		_, err = tx.ExecContext(ctx, fmt.Sprintf(`
+			UPDATE %[1]s
+			SET position = renumbered.position
+			FROM (
+				SELECT %[2]s, movie_id, row_number() OVER (PARTITION BY %[2]s ORDER BY position, movie_id) AS position
+				FROM %[1]s
+				WHERE %[2]s IN (SELECT %[2]s FROM %[1]s WHERE movie_id = $1)
+			) AS renumbered
+			WHERE %[1]s.%[2]s = renumbered.%[2]s
+			AND %[1]s.movie_id = renumbered.movie_id
+			AND %[1]s.position <> renumbered.position`, ordered.table, ordered.group), survivorID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO movie_similarity_queue (movie_id) VALUES ($1)
+		ON CONFLICT (movie_id) DO NOTHING`, survivorID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = bumpMovieVersion(ctx, tx, survivorID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	moved, err := json.Marshal(merge.Moved)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		INSERT INTO movie_merges (user_id, survivor_id, duplicate_id, duplicate_title, duplicate_year, duplicate_runtime, duplicate_genres, moved)
+		VALUES (NULLIF($1, 0), $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id, created_at`
+
+	args := []any{
+		userID,
+		survivorID,
+		duplicate.ID,
+		duplicate.Title,
+		duplicate.Year,
+		duplicate.Runtime,
+		pq.Array(duplicate.Genres),
+		moved,
+	}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&merge.ID, &merge.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return merge, tx.Commit()
+}
+
+// GetAll returns the audit log of merges, newest first. A survivorID of 0 returns the
+// merges into every movie.
+func (m MergeModel) GetAll(survivorID int64, filters Filters) ([]*MovieMerge, Metadata, error) {
+	query := `
+		SELECT count(*) OVER(), id, created_at, COALESCE(user_id, 0), survivor_id,
+			duplicate_id, duplicate_title, duplicate_year, duplicate_runtime, duplicate_genres, moved
+		FROM movie_merges
+		WHERE (survivor_id = $1 OR $1 = 0)
+		ORDER BY created_at DESC, id DESC
+		LIMIT $2 OFFSET $3`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, survivorID, filters.limit(), filters.offfset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	merges := []*MovieMerge{}
+
+	for rows.Next() {
+		var (
+			merge     MovieMerge
+			duplicate Movie
+			moved     []byte
+		)
+
+		err := rows.Scan(
+			&totalRecords,
+			&merge.ID,
+			&merge.CreatedAt,
+			&merge.UserID,
+			&merge.SurvivorID,
+			&duplicate.ID,
+			&duplicate.Title,
+			&duplicate.Year,
+			&duplicate.Runtime,
+			pq.Array(&duplicate.Genres),
+			&moved,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		err = json.Unmarshal(moved, &merge.Moved)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		merge.Duplicate = &duplicate
+		merges = append(merges, &merge)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := CalculateMetaData(totalRecords, filters.Page, filters.PageSize, TotalExact)
+
+	return merges, metadata, nil
+}
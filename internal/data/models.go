@@ -11,17 +11,41 @@ var (
 )
 
 type Models struct {
-	Movies      MovieModel
-	Users       UserModel
-	Tokens      TokenModel
-	Permissions PermissionModel
+	Movies       MovieModel
+	Users        UserModel
+	Tokens       TokenModel
+	Permissions  PermissionModel
+	People       PersonModel
+	Watchlist    WatchlistModel
+	Lists        ListModel
+	Revisions    RevisionModel
+	Genres       GenreModel
+	Images       ImageModel
+	Similarities SimilarityModel
+	Franchises   FranchiseModel
+	Translations TranslationModel
+	Releases     ReleaseModel
+	Merges       MergeModel
+	Submissions  SubmissionModel
 }
 
 func NewModel(db *sql.DB) Models {
 	return Models{
-		Movies:      MovieModel{DB: db},
-		Users:       UserModel{DB: db},
-		Tokens:      TokenModel{DB: db},
-		Permissions: PermissionModel{DB: db},
+		Movies:       MovieModel{DB: db},
+		Users:        UserModel{DB: db},
+		Tokens:       TokenModel{DB: db},
+		Permissions:  PermissionModel{DB: db},
+		People:       PersonModel{DB: db},
+		Watchlist:    WatchlistModel{DB: db},
+		Lists:        ListModel{DB: db},
+		Revisions:    RevisionModel{DB: db},
+		Genres:       GenreModel{DB: db},
+		Images:       ImageModel{DB: db},
+		Similarities: SimilarityModel{DB: db},
+		Franchises:   FranchiseModel{DB: db},
+		Translations: TranslationModel{DB: db},
+		Releases:     ReleaseModel{DB: db},
+		Merges:       MergeModel{DB: db},
+		Submissions:  SubmissionModel{DB: db},
 	}
 }
@@ -3,9 +3,14 @@ package data
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
+	"unicode"
 
 	"github.com/lib/pq"
 	"github.com/markponce/greenlight/internal/validator"
@@ -19,9 +24,42 @@ type Movie struct {
 	Runtime   Runtime   `json:"runtime,omitzero"`
 	Genres    []string  `json:"genres,omitempty"`
 	Vesion    int32     `json:"version"`
+	// Status is where the movie is in the publishing workflow, and PublishAt is when a
+	// scheduled movie is due to be published.
+	Status    string     `json:"status,omitempty"`
+	PublishAt *time.Time `json:"publish_at,omitempty"`
+	// DeletedAt is only set for movies that are in the trash.
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	// Relevance and Highlight are only set when listing movies with a title search.
+	// Relevance scores how well the title matches, and Highlight is the title with
+	// the matching words wrapped in <mark> tags.
+	Relevance float64 `json:"relevance,omitzero"`
+	Highlight string  `json:"highlight,omitzero"`
+	// Images holds the movie's posters and stills, when they've been loaded.
+	Images []*MovieImage `json:"images,omitempty"`
+	// Locale and Synopsis are only set when the movie has been localized, in which
+	// case Title is the localized title and OriginalTitle the one it was stored with.
+	Locale        string `json:"locale,omitempty"`
+	Synopsis      string `json:"synopsis,omitempty"`
+	OriginalTitle string `json:"original_title,omitempty"`
 }
 
-func ValidateMovie(v *validator.Validator, movie *Movie) {
+// The statuses a movie can have. Only published movies are shown to users who can't
+// edit movies.
+const (
+	StatusDraft     = "draft"
+	StatusScheduled = "scheduled"
+	StatusPublished = "published"
+	StatusArchived  = "archived"
+)
+
+// StatusSafelist holds every valid movie status.
+var StatusSafelist = []string{StatusDraft, StatusScheduled, StatusPublished, StatusArchived}
+
+// ValidateMovie checks a movie before it's saved. Its genres are also checked against
+// the taxonomy, with any aliases being replaced by the canonical slugs. A nil
+// taxonomy skips that check.
+func ValidateMovie(v *validator.Validator, movie *Movie, taxonomy Taxonomy) {
 	v.Check(movie.Title != "", "title", "must be provided")
 	v.Check(len(movie.Title) <= 500, "title", "must not be more than 500 bytes long")
 
@@ -36,6 +74,22 @@ func ValidateMovie(v *validator.Validator, movie *Movie) {
 	v.Check(len(movie.Genres) >= 1, "genres", "must contain at least 1 genre")
 	v.Check(len(movie.Genres) <= 5, "genres", "must not contain more than 5 genres")
 	v.Check(validator.Unique(movie.Genres), "genres", "must not contain duplicate values")
+
+	// An empty status leaves it as it is, or makes a new movie published.
+	v.Check(movie.Status == "" || validator.PermittedValue(movie.Status, StatusSafelist...), "status", "must be one of draft, scheduled, published or archived")
+	v.Check(movie.Status != StatusScheduled || movie.PublishAt != nil, "publish_at", "must be provided for scheduled movies")
+
+	if taxonomy != nil && movie.Genres != nil {
+		var unknown []string
+
+		movie.Genres, unknown = canonicalGenres(taxonomy, movie.Genres)
+		if len(unknown) > 0 {
+			v.AddError("genres", unknownGenresMessage(unknown))
+		}
+
+		// Two aliases of the same genre end up as duplicates once mapped.
+		v.Check(validator.Unique(movie.Genres), "genres", "must not contain more than one name for the same genre")
+	}
 }
 
 type MovieModel struct {
@@ -46,25 +100,39 @@ func (m *MovieModel) List(*[]Movie) error {
 	return nil
 }
 
-func (m *MovieModel) Insert(movie *Movie) error {
+// Insert adds a new movie and records its first revision against the given user.
+// Movies without a status are published straight away.
+func (m *MovieModel) Insert(movie *Movie, userID int64) error {
+	// Create a context with a 3-second timeout.
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.withTx(ctx, func(tx *sql.Tx) error {
+		return m.insertTx(ctx, tx, movie, userID)
+	})
+}
+
+// insertTx does the work of Insert() within an existing transaction.
+func (m *MovieModel) insertTx(ctx context.Context, tx *sql.Tx, movie *Movie, userID int64) error {
 	// query statement
 	query := `
 
-		INSERT INTO movies(title, year, runtime, genres)
-		VALUES ($1,$2,$3,$4)
-		RETURNING id, created_at, version
+		INSERT INTO movies(title, year, runtime, genres, status, publish_at)
+		VALUES ($1,$2,$3,$4,COALESCE(NULLIF($5, ''), 'published'),$6)
+		RETURNING id, created_at, version, status
 	`
 	// create slice type any for the arguments
 	args := []any{
-		movie.Title, movie.Year, movie.Runtime, pq.Array(movie.Genres),
+		movie.Title, movie.Year, movie.Runtime, pq.Array(movie.Genres), movie.Status, movie.PublishAt,
 	}
 
-	// Create a context with a 3-second timeout.
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-
 	// execute statement in the db. convert args using variadics and reference to update the movie id, createdAt, version
-	return m.DB.QueryRowContext(ctx, query, args...).Scan(&movie.ID, &movie.CreatedAt, &movie.Vesion)
+	err := tx.QueryRowContext(ctx, query, args...).Scan(&movie.ID, &movie.CreatedAt, &movie.Vesion, &movie.Status)
+	if err != nil {
+		return err
+	}
+
+	return insertRevision(ctx, tx, movie, RevisionInsert, userID)
 }
 
 func (m *MovieModel) Get(id int64) (*Movie, error) {
@@ -75,9 +143,9 @@ func (m *MovieModel) Get(id int64) (*Movie, error) {
 
 	// query statement
 	stmt := `
-		SELECT id, created_at, title, year, runtime, genres, version
+		SELECT id, created_at, title, year, runtime, genres, version, status, publish_at
 		from movies 
-		where id=$1
+		where id=$1 and deleted_at is null
 	`
 
 	// movie variable
@@ -95,6 +163,8 @@ func (m *MovieModel) Get(id int64) (*Movie, error) {
 		&movie.Runtime,
 		pq.Array(&movie.Genres),
 		&movie.Vesion,
+		&movie.Status,
+		&movie.PublishAt,
 	)
 
 	// check for result
@@ -112,14 +182,31 @@ func (m *MovieModel) Get(id int64) (*Movie, error) {
 	return &movie, nil
 }
 
-func (m *MovieModel) Update(movie *Movie) error {
+// Update saves the changes to a movie and records the new revision against the
+// given user. It returns ErrEditConflict if the movie has been changed (or
+// deleted) since it was read. If the movie's Status is empty, its status and
+// publish_at are left as they are.
+func (m *MovieModel) Update(movie *Movie, userID int64) error {
+	// Create a context with a 3-second timeout.
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.withTx(ctx, func(tx *sql.Tx) error {
+		return m.updateTx(ctx, tx, movie, userID)
+	})
+}
+
+// updateTx does the work of Update() within an existing transaction.
+func (m *MovieModel) updateTx(ctx context.Context, tx *sql.Tx, movie *Movie, userID int64) error {
 	// update query statement
 	// avoid race condition where version
 	stmt := `
 		UPDATE movies
-		SET title = $1, year = $2, runtime = $3, genres = $4, version = version + 1
-		where id = $5 and version = $6
-		returning version
+		SET title = $1, year = $2, runtime = $3, genres = $4, version = version + 1,
+			status = COALESCE(NULLIF($7, ''), status),
+			publish_at = CASE WHEN $7 = '' THEN publish_at ELSE $8 END
+		where id = $5 and version = $6 and deleted_at is null
+		returning version, status, publish_at
 		`
 	// create slice any for the arguments
 	args := []any{
@@ -129,13 +216,11 @@ func (m *MovieModel) Update(movie *Movie) error {
 		pq.Array(movie.Genres),
 		movie.ID,
 		movie.Vesion,
+		movie.Status,
+		movie.PublishAt,
 	}
 
-	// Create a context with a 3-second timeout.
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-
-	err := m.DB.QueryRowContext(ctx, stmt, args...).Scan(&movie.Vesion)
+	err := tx.QueryRowContext(ctx, stmt, args...).Scan(&movie.Vesion, &movie.Status, &movie.PublishAt)
 	if err != nil {
 		switch {
 		// if no updated record it means that the record has been updated already (data race condition)
@@ -147,72 +232,335 @@ func (m *MovieModel) Update(movie *Movie) error {
 
 	}
 
-	return nil
+	return insertRevision(ctx, tx, movie, RevisionUpdate, userID)
 }
 
-func (m *MovieModel) Delete(id int64) error {
+// Delete moves a movie to the trash and records the deletion against the given
+// user. If version is non-zero, the movie is only deleted if it is still at that
+// version, and ErrEditConflict is returned if it isn't.
+func (m *MovieModel) Delete(id int64, version int32, userID int64) error {
 	// if less than 1 return standard app error ErrRecordNotFound
 	if id < 1 {
 		return ErrRecordNotFound
 	}
 
-	// query statement
-	query := `
-		DELETE FROM movies
-		where id = $1
-	`
-
 	// Create a context with a 3-second timeout.
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
+	// Delete the movie and record its revision in a single transaction.
+	return m.withTx(ctx, func(tx *sql.Tx) error {
+		return m.deleteTx(ctx, tx, id, version, userID)
+	})
+}
+
+// deleteTx does the work of Delete() within an existing transaction.
+func (m *MovieModel) deleteTx(ctx context.Context, tx *sql.Tx, id int64, version int32, userID int64) error {
+	// Rather than deleting the row, move the movie to the trash. It'll be purged
+	// permanently by PurgeDeleted() once it has been there for long enough. Until
+	// then it stays in its lists, hidden, so that restoring it puts it back.
+	query := `
+		UPDATE movies
+		SET deleted_at = NOW(), version = version + 1
+		where id = $1 and deleted_at is null and (version = $2 or $2 = 0)
+		returning id, created_at, title, year, runtime, genres, version
+	`
+
+	var movie Movie
+
 	// execute query
-	result, err := m.DB.ExecContext(ctx, query, id)
+	err := tx.QueryRowContext(ctx, query, id, version).Scan(
+		&movie.ID,
+		&movie.CreatedAt,
+		&movie.Title,
+		&movie.Year,
+		&movie.Runtime,
+		pq.Array(&movie.Genres),
+		&movie.Vesion,
+	)
 	if err != nil {
-		return err
+		switch {
+		// if there is no result, return standard app error ErrRecordNotFound, unless
+		// the movie exists but has moved on from the expected version
+		case errors.Is(err, sql.ErrNoRows) && version != 0:
+			// Check on the transaction's own connection, rather than taking another
+			// one from the pool while this one is still held.
+			var deletedAt *time.Time
+
+			err = tx.QueryRowContext(ctx, `SELECT deleted_at FROM movies WHERE id = $1`, id).Scan(&deletedAt)
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrRecordNotFound
+			case err != nil:
+				return err
+			case deletedAt != nil:
+				return ErrRecordNotFound
+			default:
+				return ErrEditConflict
+			}
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
 	}
 
-	//check for row result
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		return err
+	// deletion is successfull
+	return insertRevision(ctx, tx, &movie, RevisionDelete, userID)
+}
+
+// MovieCriteria holds the optional conditions used to narrow down a list of
+// movies. Zero values mean that the corresponding condition is not applied. Movies
+// in the trash are always excluded, as are unpublished ones unless
+// IncludeUnpublished is set.
+type MovieCriteria struct {
+	// Title matches titles containing all of its words, or failing that, titles
+	// which are similar to it, so that small typos are tolerated. Localized titles
+	// are matched too, using the text search configuration for their language.
+	Title string
+	// TitlePrefix matches titles with words starting with each of its words, for
+	// autocompletion as the title is being typed.
+	TitlePrefix string
+	// Highlight asks for the words matched by Title or TitlePrefix to be marked up
+	// in Movie.Highlight.
+	Highlight bool
+	Genres    []string
+	// GenresMode is either "all", to match movies which have every one of Genres, or
+	// "any", to match movies which have at least one of them. It defaults to "all".
+	GenresMode    string
+	ExcludeGenres []string
+	PersonID      int64
+	Director      string
+	YearMin       int32
+	YearMax       int32
+	RuntimeMin    int32
+	RuntimeMax    int32
+
+	// FranchiseID matches the movies in the given franchise.
+	FranchiseID int64
+
+	// Country matches the movies released in the given country, and the rest of the
+	// release conditions apply to the releases there. ReleasedFrom and ReleasedTo
+	// are inclusive dates in the DateLayout format, and MaxCertification matches
+	// movies certified no more restrictively than it.
+	Country          string
+	ReleasedFrom     string
+	ReleasedTo       string
+	MaxCertification string
+
+	// Status matches the movies with the given status. Unless IncludeUnpublished is
+	// set, only published movies are matched anyway, whatever Status is.
+	Status             string
+	IncludeUnpublished bool
+}
+
+func ValidateMovieCriteria(v *validator.Validator, c MovieCriteria) {
+	v.Check(c.GenresMode == "" || validator.PermittedValue(c.GenresMode, "all", "any"), "genres_mode", "must be either all or any")
+	v.Check(validator.Unique(c.Genres), "genres", "must not contain duplicate values")
+	v.Check(validator.Unique(c.ExcludeGenres), "exclude_genres", "must not contain duplicate values")
+
+	for _, genre := range c.ExcludeGenres {
+		v.Check(!slices.Contains(c.Genres, genre), "exclude_genres", "must not contain any of the genres being filtered on")
 	}
 
-	// if there is no result, return standard app error ErrRecordNotFound
-	if rowsAffected == 0 {
-		return ErrRecordNotFound
+	v.Check(c.YearMin >= 0, "year_min", "must be a positive integer")
+	v.Check(c.YearMax >= 0, "year_max", "must be a positive integer")
+	v.Check(c.YearMax == 0 || c.YearMin <= c.YearMax, "year_max", "must not be less than year_min")
+
+	v.Check(c.RuntimeMin >= 0, "runtime_min", "must be a positive integer")
+	v.Check(c.RuntimeMax >= 0, "runtime_max", "must be a positive integer")
+	v.Check(c.RuntimeMax == 0 || c.RuntimeMin <= c.RuntimeMax, "runtime_max", "must not be less than runtime_min")
+
+	v.Check(c.Country == "" || ValidCountry(c.Country), "country", "must be a valid ISO 3166-1 alpha-2 country code")
+	v.Check(c.ReleasedFrom == "" || ValidDate(c.ReleasedFrom), "released_from", "must be a date in the format YYYY-MM-DD")
+	v.Check(c.ReleasedTo == "" || ValidDate(c.ReleasedTo), "released_to", "must be a date in the format YYYY-MM-DD")
+	v.Check(c.ReleasedFrom == "" || c.ReleasedTo == "" || c.ReleasedFrom <= c.ReleasedTo, "released_to", "must not be before released_from")
+
+	v.Check(c.ReleasedFrom == "" || c.Country != "", "released_from", "requires a country")
+	v.Check(c.ReleasedTo == "" || c.Country != "", "released_to", "requires a country")
+	v.Check(c.MaxCertification == "" || c.Country != "", "max_certification", "requires a country")
+
+	v.Check(c.Status == "" || validator.PermittedValue(c.Status, StatusSafelist...), "status", "must be one of draft, scheduled, published or archived")
+}
+
+// where returns the SQL conditions for the criteria along with their arguments.
+// The placeholders are numbered from $1, so any additional arguments must be
+// appended after the ones returned here.
+func (c MovieCriteria) where() (string, []any) {
+	// The genres operator is chosen here rather than in SQL so that the GIN index on
+	// genres can be used for either mode.
+	genresOperator := "@>"
+	if c.GenresMode == "any" {
+		genresOperator = "&&"
 	}
 
-	// deletion is successfull
-	return nil
+	conditions := `
+	movies.deleted_at IS NULL
+	AND (
+		to_tsvector('simple', movies.title) @@ plainto_tsquery('simple', $1)
+		OR $1 <% movies.title
+		OR movies.id IN (
+			SELECT movie_id FROM movie_translations
+			WHERE to_tsvector(search_config, title) @@ plainto_tsquery(search_config, $1)
+			OR $1 <% title
+		)
+		OR $1 = ''
+	)
+	AND (to_tsvector('simple', movies.title) @@ to_tsquery('simple', $10) OR $10 = '')
+	AND (movies.genres ` + genresOperator + ` $2 OR $2 = '{}')
+	AND (movies.id IN (
+		SELECT movie_id FROM movies_people WHERE person_id = $3
+	) OR $3 = 0)
+	AND (movies.id IN (
+		SELECT movies_people.movie_id
+		FROM movies_people
+		INNER JOIN people ON people.id = movies_people.person_id
+		WHERE movies_people.role = 'director'
+		AND to_tsvector('simple', people.name) @@ plainto_tsquery('simple', $4)
+	) OR $4 = '')
+	AND (NOT movies.genres && $5 OR $5 = '{}')
+	AND (movies.year >= $6 OR $6 = 0)
+	AND (movies.year <= $7 OR $7 = 0)
+	AND (movies.runtime >= $8 OR $8 = 0)
+	AND (movies.runtime <= $9 OR $9 = 0)
+	AND (movies.id IN (
+		SELECT movie_id FROM franchises_movies WHERE franchise_id = $11
+	) OR $11 = 0)
+	AND (movies.id IN (
+		SELECT movie_releases.movie_id
+		FROM movie_releases
+		LEFT JOIN certifications ON certifications.country = movie_releases.country
+			AND certifications.code = movie_releases.certification
+		WHERE movie_releases.country = $12
+		AND (movie_releases.release_date >= NULLIF($13, '')::date OR $13 = '')
+		AND (movie_releases.release_date <= NULLIF($14, '')::date OR $14 = '')
+		AND (certifications.rank <= (
+			SELECT rank FROM certifications WHERE country = $12 AND code = $15
+		) OR $15 = '')
+	) OR $12 = '')
+	AND (movies.status = $16 OR $16 = '')
+	AND (movies.status = 'published' OR $17)`
+
+	// A nil slice would be sent as NULL rather than an empty array, which would make
+	// the genre conditions fail to match anything.
+	if c.Genres == nil {
+		c.Genres = []string{}
+	}
+	if c.ExcludeGenres == nil {
+		c.ExcludeGenres = []string{}
+	}
+
+	args := []any{
+		c.Title,
+		pq.Array(c.Genres),
+		c.PersonID,
+		c.Director,
+		pq.Array(c.ExcludeGenres),
+		c.YearMin,
+		c.YearMax,
+		c.RuntimeMin,
+		c.RuntimeMax,
+		prefixQuery(c.TitlePrefix),
+		c.FranchiseID,
+		c.Country,
+		c.ReleasedFrom,
+		c.ReleasedTo,
+		c.MaxCertification,
+		c.Status,
+		c.IncludeUnpublished,
+	}
+
+	return conditions, args
+}
+
+// relevanceExpression scores how well a movie's title matches the title search in
+// $1, combining the full text rank with the trigram word similarity so that typos
+// still score.
+const relevanceExpression = `(ts_rank(to_tsvector('simple', movies.title), plainto_tsquery('simple', $1)) + word_similarity($1, movies.title))`
+
+// columns returns the SQL for the relevance and highlight columns selected
+// alongside each movie, using the placeholders from where().
+func (c MovieCriteria) columns() string {
+	relevance := "0::real"
+	if c.Title != "" {
+		relevance = relevanceExpression
+	}
+
+	highlight := "''"
+	if c.Highlight {
+		switch {
+		case c.Title != "":
+			highlight = `ts_headline('simple', movies.title, plainto_tsquery('simple', $1), 'StartSel=<mark>, StopSel=</mark>, HighlightAll=true')`
+		case c.TitlePrefix != "":
+			highlight = `ts_headline('simple', movies.title, to_tsquery('simple', $10), 'StartSel=<mark>, StopSel=</mark>, HighlightAll=true')`
+		}
+	}
+
+	return relevance + ", " + highlight
+}
+
+// prefixQuery turns search text into a tsquery matching each of its words as a
+// prefix, so "the godf" becomes "the:* & godf:*". Anything other than letters and
+// digits is dropped, so that the result is always a valid tsquery.
+func prefixQuery(s string) string {
+	words := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	for i := range words {
+		words[i] += ":*"
+	}
+
+	return strings.Join(words, " & ")
 }
 
-func (m *MovieModel) GetAll(title string, genres []string, filter Filters) ([]*Movie, Metadata, error) {
+// movieSort returns the SQL expression and direction to order movies by. Sorting by
+// relevance always puts the best matches first.
+func movieSort(filter Filters) (string, string) {
+	column := filter.sortColumn()
+
+	if column == "relevance" {
+		return relevanceExpression, "DESC"
+	}
+
+	return "movies." + column, filter.sortDirection()
+}
+
+func (m *MovieModel) GetAll(criteria MovieCriteria, filter Filters) ([]*Movie, Metadata, error) {
+	if filter.Cursor != "" {
+		return m.getAllByCursor(criteria, filter)
+	}
+	if filter.Total == TotalNone || filter.Total == TotalEstimated {
+		return m.getAllWithoutCount(criteria, filter)
+	}
+
+	// Build the filter conditions, then append the pagination arguments after them.
+	conditions, args := criteria.where()
+	args = append(args, filter.limit(), filter.offfset())
+
 	// Construct the SQL query to retrieve all movie records.
 	// Update the SQL query to include the filter conditions.
+	sort, direction := movieSort(filter)
+
 	query := fmt.Sprintf(`
-	SELECT count(*) OVER(), id, created_at, title, year, runtime, genres, version
+	SELECT count(*) OVER(), id, created_at, title, year, runtime, genres, version, status, publish_at, %s
 	FROM movies
-	WHERE (to_tsvector('simple', title) @@ plainto_tsquery('simple', $1) OR $1 = '') 
-	AND (genres @> $2 OR $2 = '{}')     
+	WHERE %s
 	ORDER BY %s %s, id ASC 
-	LIMIT $3 OFFSET $4 
+	LIMIT $%d OFFSET $%d 
 	`,
-		filter.sortColumn(),
-		filter.sortDirection(),
+		criteria.columns(),
+		conditions,
+		sort,
+		direction,
+		len(args)-1,
+		len(args),
 	)
 
 	// Create a context with a 3-second timeout.
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	args := []any{
-		title,
-		pq.Array(genres),
-		filter.limit(),
-		filter.offfset(),
-	}
-
 	// Use QueryContext() to execute the query. This returns a sql.Rows resultset
 	// containing the result.
 	rows, err := m.DB.QueryContext(ctx, query, args...)
@@ -242,6 +590,10 @@ func (m *MovieModel) GetAll(title string, genres []string, filter Filters) ([]*M
 			&movie.Runtime,
 			pq.Array(&movie.Genres),
 			&movie.Vesion,
+			&movie.Status,
+			&movie.PublishAt,
+			&movie.Relevance,
+			&movie.Highlight,
 		)
 
 		if err != nil {
@@ -258,9 +610,789 @@ func (m *MovieModel) GetAll(title string, genres []string, filter Filters) ([]*M
 		return nil, Metadata{}, err
 	}
 
-	metedata := CalculateMetaData(totalRecords, filter.Page, filter.PageSize)
+	metedata := CalculateMetaData(totalRecords, filter.Page, filter.PageSize, TotalExact)
+
+	// Hand out cursors for the neighbouring pages too, so that a client can switch to
+	// keyset pagination from any page.
+	if len(movies) > 0 {
+		column := filter.sortColumn()
+		first, last := movies[0], movies[len(movies)-1]
+
+		if metedata.CurrentPage < metedata.LastPage {
+			metedata.NextCursor = filter.cursorAfter(movieSortValue(last, column), last.ID)
+		}
+		if filter.Page > 1 {
+			metedata.PrevCursor = filter.cursorBefore(movieSortValue(first, column), first.ID)
+		}
+	}
 
 	// If everything went OK, then return the slice of movies.
 	return movies, metedata, nil
 
 }
+
+// getAllByCursor returns the page of movies before or after the row marked by the
+// cursor in filter. Rather than skipping over the earlier rows with OFFSET, it seeks
+// straight to the cursor position, which stays fast however deep the page is and
+// doesn't skip or repeat rows when movies are added or removed in between requests.
+// There's no total count in this mode, and the metadata only holds the page size and
+// the cursors for the neighbouring pages.
+func (m *MovieModel) getAllByCursor(criteria MovieCriteria, filter Filters) ([]*Movie, Metadata, error) {
+	c, err := decodeCursor(filter.Cursor)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	column := filter.sortColumn()
+	sort, direction := movieSort(filter)
+
+	// Ties on the sort column are always broken by ascending ID, as in GetAll(). To
+	// page backwards, the comparisons and the ordering are reversed, and the rows are
+	// put back the right way round afterwards.
+	ascending := direction == "ASC"
+	if c.Before {
+		ascending = !ascending
+	}
+
+	compare, order := ">", "ASC"
+	if !ascending {
+		compare, order = "<", "DESC"
+	}
+
+	idCompare, idOrder := ">", "ASC"
+	if c.Before {
+		idCompare, idOrder = "<", "DESC"
+	}
+
+	// Fetch one extra row to find out whether there's another page beyond this one.
+	conditions, args := criteria.where()
+	args = append(args, c.Value, c.ID, filter.limit()+1)
+
+	query := fmt.Sprintf(`
+	SELECT id, created_at, title, year, runtime, genres, version, status, publish_at, %s
+	FROM movies
+	WHERE %s
+	AND (%s %s $%d OR (%s = $%d AND movies.id %s $%d))
+	ORDER BY %s %s, movies.id %s
+	LIMIT $%d`,
+		criteria.columns(),
+		conditions,
+		sort, compare, len(args)-2, sort, len(args)-2, idCompare, len(args)-1,
+		sort, order, idOrder,
+		len(args),
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	movies, err := m.queryMovies(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	more := len(movies) > filter.limit()
+	if more {
+		movies = movies[:filter.limit()]
+	}
+
+	if c.Before {
+		slices.Reverse(movies)
+	}
+
+	totalRecords, accuracy, err := m.count(criteria, filter.Total)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := Metadata{PageSize: filter.PageSize, TotalRecordsAccuracy: accuracy}
+
+	if accuracy != TotalNone {
+		metadata.TotalRecords = totalRecords
+	}
+
+	if len(movies) > 0 {
+		first, last := movies[0], movies[len(movies)-1]
+
+		// Coming from a cursor means there's always at least one row on the side we
+		// came from, so only the far side depends on the extra row.
+		if more || c.Before {
+			metadata.NextCursor = filter.cursorAfter(movieSortValue(last, column), last.ID)
+		}
+		if more || !c.Before {
+			metadata.PrevCursor = filter.cursorBefore(movieSortValue(first, column), first.ID)
+		}
+	}
+
+	return movies, metadata, nil
+}
+
+// getAllWithoutCount returns a page of movies like GetAll() does, but without
+// counting every matching row with count(*) OVER(). The total is either left out of
+// the metadata or estimated, depending on filter.Total. An extra row is fetched to
+// find out whether there's a next page, since the last page isn't known.
+func (m *MovieModel) getAllWithoutCount(criteria MovieCriteria, filter Filters) ([]*Movie, Metadata, error) {
+	conditions, args := criteria.where()
+	args = append(args, filter.limit()+1, filter.offfset())
+
+	sort, direction := movieSort(filter)
+
+	query := fmt.Sprintf(`
+	SELECT id, created_at, title, year, runtime, genres, version, status, publish_at, %s
+	FROM movies
+	WHERE %s
+	ORDER BY %s %s, id ASC
+	LIMIT $%d OFFSET $%d`,
+		criteria.columns(),
+		conditions,
+		sort,
+		direction,
+		len(args)-1,
+		len(args),
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	movies, err := m.queryMovies(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	more := len(movies) > filter.limit()
+	if more {
+		movies = movies[:filter.limit()]
+	}
+
+	totalRecords, accuracy, err := m.count(criteria, filter.Total)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := CalculateMetaData(totalRecords, filter.Page, filter.PageSize, accuracy)
+
+	if len(movies) > 0 {
+		column := filter.sortColumn()
+		first, last := movies[0], movies[len(movies)-1]
+
+		if more {
+			metadata.NextCursor = filter.cursorAfter(movieSortValue(last, column), last.ID)
+		}
+		if filter.Page > 1 {
+			metadata.PrevCursor = filter.cursorBefore(movieSortValue(first, column), first.ID)
+		}
+	}
+
+	return movies, metadata, nil
+}
+
+// queryMovies runs a query selecting the id, created_at, title, year, runtime, genres,
+// version, status and publish_at columns followed by MovieCriteria.columns(), and
+// returns the movies it finds.
+func (m *MovieModel) queryMovies(ctx context.Context, query string, args ...any) ([]*Movie, error) {
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	movies := []*Movie{}
+
+	for rows.Next() {
+		var movie Movie
+
+		err := rows.Scan(
+			&movie.ID,
+			&movie.CreatedAt,
+			&movie.Title,
+			&movie.Year,
+			&movie.Runtime,
+			pq.Array(&movie.Genres),
+			&movie.Vesion,
+			&movie.Status,
+			&movie.PublishAt,
+			&movie.Relevance,
+			&movie.Highlight,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		movies = append(movies, &movie)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return movies, nil
+}
+
+// estimateThreshold is the number of rows above which an estimated count is used
+// as it is. Below it, counting exactly is cheap enough that it's done instead.
+const estimateThreshold = 10_000
+
+// count returns the number of movies matching the criteria, using the given total
+// mode, along with the mode actually used. TotalNone skips counting altogether.
+// TotalEstimated asks the query planner how many rows it expects the query to return,
+// falling back to an exact count when that's below estimateThreshold, since planner
+// estimates are least reliable for small and heavily filtered results.
+func (m *MovieModel) count(criteria MovieCriteria, total string) (int, string, error) {
+	if total == TotalNone {
+		return 0, TotalNone, nil
+	}
+
+	conditions, args := criteria.where()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	if total == TotalEstimated {
+		query := fmt.Sprintf(`
+		EXPLAIN (FORMAT JSON)
+		SELECT id FROM movies
+		WHERE %s`, conditions)
+
+		var js []byte
+
+		err := m.DB.QueryRowContext(ctx, query, args...).Scan(&js)
+		if err != nil {
+			return 0, "", err
+		}
+
+		var plan []struct {
+			Plan struct {
+				Rows float64 `json:"Plan Rows"`
+			} `json:"Plan"`
+		}
+
+		err = json.Unmarshal(js, &plan)
+		if err != nil {
+			return 0, "", err
+		}
+
+		if len(plan) > 0 && plan[0].Plan.Rows >= estimateThreshold {
+			return int(plan[0].Plan.Rows), TotalEstimated, nil
+		}
+	}
+
+	query := fmt.Sprintf(`
+	SELECT count(*) FROM movies
+	WHERE %s`, conditions)
+
+	var totalRecords int
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&totalRecords)
+	if err != nil {
+		return 0, "", err
+	}
+
+	return totalRecords, TotalExact, nil
+}
+
+// movieSortValue returns the value of a movie's sort column, in the text form used
+// in cursors.
+func movieSortValue(movie *Movie, column string) string {
+	switch column {
+	case "title":
+		return movie.Title
+	case "year":
+		return strconv.Itoa(int(movie.Year))
+	case "runtime":
+		return strconv.Itoa(int(movie.Runtime))
+	case "relevance":
+		return strconv.FormatFloat(movie.Relevance, 'g', -1, 64)
+	default:
+		return strconv.FormatInt(movie.ID, 10)
+	}
+}
+
+// Export calls fn for every movie matching the criteria, in ID order. The movies are
+// read from the database one at a time as fn consumes them, rather than being loaded
+// into memory all at once, so the whole catalog can be exported. Unlike the other
+// methods there's no fixed timeout; instead the export stops when ctx is cancelled or
+// when fn returns an error.
+func (m *MovieModel) Export(ctx context.Context, criteria MovieCriteria, fn func(*Movie) error) error {
+	conditions, args := criteria.where()
+
+	query := fmt.Sprintf(`
+	SELECT id, created_at, title, year, runtime, genres, version
+	FROM movies
+	WHERE %s
+	ORDER BY id ASC`, conditions)
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var movie Movie
+
+		err := rows.Scan(
+			&movie.ID,
+			&movie.CreatedAt,
+			&movie.Title,
+			&movie.Year,
+			&movie.Runtime,
+			pq.Array(&movie.Genres),
+			&movie.Vesion,
+		)
+		if err != nil {
+			return err
+		}
+
+		err = fn(&movie)
+		if err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// MovieSuggestion is a cut-down movie returned by Suggest(), holding just enough to
+// show in a search box.
+type MovieSuggestion struct {
+	ID    int64  `json:"id"`
+	Title string `json:"title"`
+	Year  int32  `json:"year"`
+}
+
+// Suggest returns up to limit published movies with titles containing words which start with
+// each of the words in q, closest matches first. It's meant to be called as a title is
+// being typed, so it only uses the title index and gives up quickly.
+func (m *MovieModel) Suggest(q string, limit int) ([]*MovieSuggestion, error) {
+	query := `
+	SELECT id, title, year
+	FROM movies
+	WHERE deleted_at IS NULL
+	AND status = 'published'
+	AND to_tsvector('simple', title) @@ to_tsquery('simple', $1)
+	ORDER BY word_similarity($2, title) DESC, title ASC, id ASC
+	LIMIT $3`
+
+	tsquery := prefixQuery(q)
+	if tsquery == "" {
+		return []*MovieSuggestion{}, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, tsquery, q, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	suggestions := []*MovieSuggestion{}
+
+	for rows.Next() {
+		var suggestion MovieSuggestion
+
+		err := rows.Scan(&suggestion.ID, &suggestion.Title, &suggestion.Year)
+		if err != nil {
+			return nil, err
+		}
+
+		suggestions = append(suggestions, &suggestion)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return suggestions, nil
+}
+
+// GetAllDeleted returns a page of the movies in the trash, most recently deleted
+// first.
+func (m *MovieModel) GetAllDeleted(filter Filters) ([]*Movie, Metadata, error) {
+	query := `
+	SELECT count(*) OVER(), id, created_at, title, year, runtime, genres, version, deleted_at
+	FROM movies
+	WHERE deleted_at IS NOT NULL
+	ORDER BY deleted_at DESC, id ASC
+	LIMIT $1 OFFSET $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, filter.limit(), filter.offfset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	movies := []*Movie{}
+
+	for rows.Next() {
+		var movie Movie
+
+		err := rows.Scan(
+			&totalRecords,
+			&movie.ID,
+			&movie.CreatedAt,
+			&movie.Title,
+			&movie.Year,
+			&movie.Runtime,
+			pq.Array(&movie.Genres),
+			&movie.Vesion,
+			&movie.DeletedAt,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		movies = append(movies, &movie)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := CalculateMetaData(totalRecords, filter.Page, filter.PageSize, TotalExact)
+
+	return movies, metadata, nil
+}
+
+// Restore takes a movie back out of the trash and records the restoration against
+// the given user. It returns ErrRecordNotFound if there is no such movie in the
+// trash.
+func (m *MovieModel) Restore(id int64, userID int64) (*Movie, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		UPDATE movies
+		SET deleted_at = NULL, version = version + 1
+		WHERE id = $1 AND deleted_at IS NOT NULL
+		RETURNING id, created_at, title, year, runtime, genres, version`
+
+	var movie Movie
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, query, id).Scan(
+		&movie.ID,
+		&movie.CreatedAt,
+		&movie.Title,
+		&movie.Year,
+		&movie.Runtime,
+		pq.Array(&movie.Genres),
+		&movie.Vesion,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	err = insertRevision(ctx, tx, &movie, RevisionRestore, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return &movie, nil
+}
+
+// PurgeDeleted permanently deletes the movies which have been in the trash for
+// longer than the retention period, and returns how many were removed. The gaps they
+// leave behind in lists and franchises are closed up. The purged movies' images are
+// returned too, with only their keys filled in, so that the caller can remove their
+// files from storage once the rows are gone.
+func (m *MovieModel) PurgeDeleted(retention time.Duration) (int64, []*MovieImage, error) {
+	cutoff := time.Now().Add(-retention)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer tx.Rollback()
+
+	// Move each movie in the affected lists and franchises up by the number of
+	// purged movies ahead of it. The purged movies' own rows go with them when
+	// they're deleted.
+	for _, collection := range []struct{ table, column string }{
+		{"lists_movies", "list_id"},
+		{"franchises_movies", "franchise_id"},
+	} {
+		_, err = tx.ExecContext(ctx, fmt.Sprintf(`
+			WITH purged AS (
+				SELECT %[1]s.%[2]s, %[1]s.position
+				FROM %[1]s
+				INNER JOIN movies ON movies.id = %[1]s.movie_id
+				WHERE movies.deleted_at < $1
+			)
+			UPDATE %[1]s
+			SET position = %[1]s.position - (
+				SELECT count(*) FROM purged
+				WHERE purged.%[2]s = %[1]s.%[2]s
+				AND purged.position < %[1]s.position
+			)
+			WHERE %[1]s.%[2]s IN (SELECT %[2]s FROM purged)`, collection.table, collection.column), cutoff)
+		if err != nil {
+			return 0, nil, err
+		}
+	}
+
+	// The images would go with the movies anyway, but deleting them here first is how
+	// their storage keys are found out.
+	rows, err := tx.QueryContext(ctx, `
+		DELETE FROM movie_images
+		USING movies
+		WHERE movies.id = movie_images.movie_id
+		AND movies.deleted_at < $1
+		RETURNING movie_images.movie_id, movie_images.storage_key`, cutoff)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer rows.Close()
+
+	images := []*MovieImage{}
+
+	for rows.Next() {
+		var img MovieImage
+
+		err := rows.Scan(&img.MovieID, &img.Key)
+		if err != nil {
+			return 0, nil, err
+		}
+
+		images = append(images, &img)
+	}
+
+	if err = rows.Err(); err != nil {
+		return 0, nil, err
+	}
+
+	result, err := tx.ExecContext(ctx, `
+		DELETE FROM movies
+		WHERE deleted_at < $1`, cutoff)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	purged, err := result.RowsAffected()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return purged, images, nil
+}
+
+// PublishScheduled publishes the scheduled movies whose publish_at has passed, and
+// returns how many were published. Each one gets a new version, recorded as an update
+// without a user.
+func (m *MovieModel) PublishScheduled() (int64, error) {
+	query := `
+		WITH published AS (
+			UPDATE movies
+			SET status = 'published', version = version + 1
+			WHERE status = 'scheduled'
+			AND publish_at <= NOW()
+			AND deleted_at IS NULL
+			RETURNING id, version, title, year, runtime, genres
+		),
+		revisions AS (
+			INSERT INTO movie_revisions (movie_id, version, operation, title, year, runtime, genres)
+			SELECT id, version, 'update', title, year, runtime, genres FROM published
+		)
+		SELECT count(*) FROM published`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var published int64
+
+	err := m.DB.QueryRowContext(ctx, query).Scan(&published)
+	if err != nil {
+		return 0, err
+	}
+
+	return published, nil
+}
+
+// The kinds of operation which can be applied in bulk.
+const (
+	OperationCreate = "create"
+	OperationUpdate = "update"
+	OperationDelete = "delete"
+)
+
+// MovieOperation is a single create, update or delete to be applied as part of a
+// bulk change. Creates and updates carry the complete new state of the movie in
+// Movie, which for updates includes the version it's expected to be at. Deletes only
+// need the ID, and are unconditional unless Version is non-zero.
+type MovieOperation struct {
+	Op      string
+	ID      int64
+	Version int32
+	Movie   *Movie
+}
+
+// Apply runs a single operation in its own transaction.
+func (m *MovieModel) Apply(op *MovieOperation, userID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.withTx(ctx, func(tx *sql.Tx) error {
+		return m.applyTx(ctx, tx, op, userID)
+	})
+}
+
+// ApplyAll runs the operations in order in a single transaction, so either all of
+// them are applied or none are. If one of them fails, its index is returned along
+// with the error.
+func (m *MovieModel) ApplyAll(ops []*MovieOperation, userID int64) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	failed := -1
+
+	err := m.withTx(ctx, func(tx *sql.Tx) error {
+		for i, op := range ops {
+			err := m.applyTx(ctx, tx, op, userID)
+			if err != nil {
+				failed = i
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	return failed, err
+}
+
+func (m *MovieModel) applyTx(ctx context.Context, tx *sql.Tx, op *MovieOperation, userID int64) error {
+	switch op.Op {
+	case OperationCreate:
+		return m.insertTx(ctx, tx, op.Movie, userID)
+	case OperationUpdate:
+		return m.updateTx(ctx, tx, op.Movie, userID)
+	case OperationDelete:
+		return m.deleteTx(ctx, tx, op.ID, op.Version, userID)
+	default:
+		return fmt.Errorf("unknown movie operation %q", op.Op)
+	}
+}
+
+// withTx runs fn inside a transaction, committing it if fn succeeds and rolling it
+// back otherwise.
+func (m *MovieModel) withTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = fn(tx)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// InsertBatch adds several movies with a single multi-row insert, recording their
+// first revisions against the given user. In upsert mode, movies which match an
+// existing one by title (ignoring case) and year update its runtime and genres
+// instead. It returns the number of movies inserted and updated.
+func (m *MovieModel) InsertBatch(movies []*Movie, upsert bool, userID int64) (int, int, error) {
+	if len(movies) == 0 {
+		return 0, 0, nil
+	}
+
+	// Build a VALUES list with one row of placeholders per movie, numbered after the
+	// user ID in $1.
+	values := make([]string, len(movies))
+	args := []any{userID}
+
+	for i, movie := range movies {
+		n := len(args)
+		values[i] = fmt.Sprintf("(%d, $%d::text, $%d::integer, $%d::integer, $%d::text[])", i, n+1, n+2, n+3, n+4)
+		args = append(args, movie.Title, movie.Year, movie.Runtime, pq.Array(movie.Genres))
+	}
+
+	// Without upsert, the updated CTE never matches anything and every row is
+	// inserted.
+	query := fmt.Sprintf(`
+	WITH input (ord, title, year, runtime, genres) AS (
+		VALUES %s
+	),
+	updated AS (
+		UPDATE movies
+		SET runtime = input.runtime, genres = input.genres, version = movies.version + 1
+		FROM input
+		WHERE $%d::boolean
+		AND lower(movies.title) = lower(input.title)
+		AND movies.year = input.year
+		AND movies.deleted_at IS NULL
+		RETURNING movies.id, movies.version, movies.title, movies.year, movies.runtime, movies.genres
+	),
+	inserted AS (
+		INSERT INTO movies (title, year, runtime, genres)
+		SELECT title, year, runtime, genres
+		FROM input
+		WHERE NOT $%d::boolean OR NOT EXISTS (
+			SELECT 1 FROM movies
+			WHERE lower(movies.title) = lower(input.title)
+			AND movies.year = input.year
+			AND movies.deleted_at IS NULL
+		)
+		ORDER BY ord
+		RETURNING id, version, title, year, runtime, genres
+	),
+	revisions AS (
+		INSERT INTO movie_revisions (movie_id, version, operation, user_id, title, year, runtime, genres)
+		SELECT id, version, 'update', NULLIF($1::bigint, 0), title, year, runtime, genres FROM updated
+		UNION ALL
+		SELECT id, version, 'insert', NULLIF($1::bigint, 0), title, year, runtime, genres FROM inserted
+	)
+	SELECT (SELECT count(*) FROM inserted), (SELECT count(*) FROM updated)`,
+		strings.Join(values, ", "),
+		len(args)+1,
+		len(args)+1,
+	)
+
+	args = append(args, upsert)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var inserted, updated int
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&inserted, &updated)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return inserted, updated, nil
+}
@@ -0,0 +1,352 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/markponce/greenlight/internal/validator"
+)
+
+// Roles a person can be credited with on a movie.
+const (
+	RoleDirector = "director"
+	RoleActor    = "actor"
+	RoleWriter   = "writer"
+)
+
+// errors specific to people and credits
+var (
+	ErrDuplicateCredit = errors.New("duplicate credit")
+	ErrUnknownPerson   = errors.New("unknown person")
+)
+
+type Person struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"-"`
+	Name      string    `json:"name"`
+	BirthYear int32     `json:"birth_year,omitzero"`
+	Version   int32     `json:"version"`
+}
+
+// Credit links a person to a movie in a given role. Character is only meaningful
+// for actors and is left empty for directors and writers.
+type Credit struct {
+	MovieID   int64  `json:"movie_id"`
+	PersonID  int64  `json:"person_id"`
+	Name      string `json:"name,omitempty"`
+	Title     string `json:"title,omitempty"`
+	Role      string `json:"role"`
+	Character string `json:"character,omitempty"`
+}
+
+func ValidatePerson(v *validator.Validator, person *Person) {
+	v.Check(person.Name != "", "name", "must be provided")
+	v.Check(len(person.Name) <= 500, "name", "must not be more than 500 bytes long")
+
+	if person.BirthYear != 0 {
+		v.Check(person.BirthYear >= 1800, "birth_year", "must be greater than 1800")
+		v.Check(person.BirthYear <= int32(time.Now().Year()), "birth_year", "must not be in the future")
+	}
+}
+
+func ValidateCredit(v *validator.Validator, credit *Credit) {
+	v.Check(credit.PersonID > 0, "person_id", "must be provided")
+	v.Check(validator.PermittedValue(credit.Role, RoleDirector, RoleActor, RoleWriter), "role", "must be one of director, actor or writer")
+	v.Check(len(credit.Character) <= 500, "character", "must not be more than 500 bytes long")
+
+	if credit.Role != RoleActor {
+		v.Check(credit.Character == "", "character", "must only be provided for actors")
+	}
+}
+
+type PersonModel struct {
+	DB *sql.DB
+}
+
+func (m PersonModel) Insert(person *Person) error {
+	query := `
+		INSERT INTO people (name, birth_year)
+		VALUES ($1, NULLIF($2, 0))
+		RETURNING id, created_at, version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, person.Name, person.BirthYear).Scan(&person.ID, &person.CreatedAt, &person.Version)
+}
+
+func (m PersonModel) Get(id int64) (*Person, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT id, created_at, name, COALESCE(birth_year, 0), version
+		FROM people
+		WHERE id = $1`
+
+	var person Person
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&person.ID,
+		&person.CreatedAt,
+		&person.Name,
+		&person.BirthYear,
+		&person.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &person, nil
+}
+
+func (m PersonModel) Update(person *Person) error {
+	query := `
+		UPDATE people
+		SET name = $1, birth_year = NULLIF($2, 0), version = version + 1
+		WHERE id = $3 AND version = $4
+		RETURNING version`
+
+	args := []any{
+		person.Name,
+		person.BirthYear,
+		person.ID,
+		person.Version,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&person.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m PersonModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+		DELETE FROM people
+		WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (m PersonModel) GetAll(name string, filters Filters) ([]*Person, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), id, created_at, name, COALESCE(birth_year, 0), version
+		FROM people
+		WHERE (to_tsvector('simple', name) @@ plainto_tsquery('simple', $1) OR $1 = '')
+		ORDER BY %s %s, id ASC
+		LIMIT $2 OFFSET $3`,
+		filters.sortColumn(),
+		filters.sortDirection(),
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, name, filters.limit(), filters.offfset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	people := []*Person{}
+
+	for rows.Next() {
+		var person Person
+
+		err := rows.Scan(
+			&totalRecords,
+			&person.ID,
+			&person.CreatedAt,
+			&person.Name,
+			&person.BirthYear,
+			&person.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		people = append(people, &person)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := CalculateMetaData(totalRecords, filters.Page, filters.PageSize, TotalExact)
+
+	return people, metadata, nil
+}
+
+// AddCredit links a person to a movie. The same person may be credited more than
+// once on a movie, as long as the role or character differs.
+func (m PersonModel) AddCredit(credit *Credit) error {
+	query := `
+		INSERT INTO movies_people (movie_id, person_id, role, character_name)
+		VALUES ($1, $2, $3, $4)`
+
+	args := []any{
+		credit.MovieID,
+		credit.PersonID,
+		credit.Role,
+		credit.Character,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, args...)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "movies_people_pkey"`:
+			return ErrDuplicateCredit
+		case err.Error() == `pq: insert or update on table "movies_people" violates foreign key constraint "movies_people_person_id_fkey"`:
+			return ErrUnknownPerson
+		case err.Error() == `pq: insert or update on table "movies_people" violates foreign key constraint "movies_people_movie_id_fkey"`:
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m PersonModel) RemoveCredit(credit *Credit) error {
+	query := `
+		DELETE FROM movies_people
+		WHERE movie_id = $1 AND person_id = $2 AND role = $3 AND character_name = $4`
+
+	args := []any{
+		credit.MovieID,
+		credit.PersonID,
+		credit.Role,
+		credit.Character,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// GetCreditsForMovie returns the cast and crew of a movie, directors first, then
+// writers, then actors, each group ordered by name.
+func (m PersonModel) GetCreditsForMovie(movieID int64) ([]*Credit, error) {
+	query := `
+		SELECT movies_people.movie_id, people.id, people.name, '', movies_people.role, movies_people.character_name
+		FROM movies_people
+		INNER JOIN people ON people.id = movies_people.person_id
+		WHERE movies_people.movie_id = $1
+		ORDER BY array_position(ARRAY['director', 'writer', 'actor'], movies_people.role), people.name, people.id`
+
+	return m.queryCredits(query, movieID)
+}
+
+// GetCreditsForPerson returns the filmography of a person, newest movies first.
+// Unpublished movies are left out unless includeUnpublished is set.
+func (m PersonModel) GetCreditsForPerson(personID int64, includeUnpublished bool) ([]*Credit, error) {
+	query := `
+		SELECT movies_people.movie_id, movies_people.person_id, '', movies.title, movies_people.role, movies_people.character_name
+		FROM movies_people
+		INNER JOIN movies ON movies.id = movies_people.movie_id
+		WHERE movies_people.person_id = $1 AND movies.deleted_at IS NULL
+		AND (movies.status = 'published' OR $2)
+		ORDER BY movies.year DESC, movies.id`
+
+	return m.queryCredits(query, personID, includeUnpublished)
+}
+
+func (m PersonModel) queryCredits(query string, args ...any) ([]*Credit, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	credits := []*Credit{}
+
+	for rows.Next() {
+		var credit Credit
+
+		err := rows.Scan(
+			&credit.MovieID,
+			&credit.PersonID,
+			&credit.Name,
+			&credit.Title,
+			&credit.Role,
+			&credit.Character,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		credits = append(credits, &credit)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return credits, nil
+}
@@ -0,0 +1,225 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/markponce/greenlight/internal/validator"
+	"golang.org/x/text/language"
+)
+
+// DateLayout is the format of release dates, in requests and responses alike.
+const DateLayout = "2006-01-02"
+
+// Release is when a movie came out in a country, and the certification it was given
+// there, if any. Countries are ISO 3166-1 alpha-2 codes like "US" or "GB".
+type Release struct {
+	MovieID       int64  `json:"-"`
+	Country       string `json:"country"`
+	ReleaseDate   string `json:"release_date"`
+	Certification string `json:"certification,omitempty"`
+}
+
+// Certification is one of the ratings a movie can be given in a country. Rank orders
+// the certifications within a country from the least to the most restrictive.
+type Certification struct {
+	Country     string `json:"country"`
+	Code        string `json:"code"`
+	Rank        int    `json:"rank"`
+	Description string `json:"description,omitempty"`
+}
+
+// Certifications maps each country to the ranks of its certifications, keyed by code.
+type Certifications map[string]map[string]int
+
+// Rank returns the rank of a certification in a country, reporting false if the
+// country doesn't have that certification.
+func (c Certifications) Rank(country, code string) (int, bool) {
+	rank, ok := c[country][code]
+	return rank, ok
+}
+
+// ValidCountry reports whether s is an ISO 3166-1 alpha-2 country code, in upper case.
+func ValidCountry(s string) bool {
+	region, err := language.ParseRegion(s)
+	return err == nil && region.IsCountry() && region.String() == s
+}
+
+// ValidDate reports whether s is a date in the DateLayout format.
+func ValidDate(s string) bool {
+	_, err := time.Parse(DateLayout, s)
+	return err == nil
+}
+
+func ValidateRelease(v *validator.Validator, release *Release, certifications Certifications) {
+	v.Check(ValidCountry(release.Country), "country", "must be a valid ISO 3166-1 alpha-2 country code")
+
+	v.Check(release.ReleaseDate != "", "release_date", "must be provided")
+	v.Check(release.ReleaseDate == "" || ValidDate(release.ReleaseDate), "release_date", "must be a date in the format YYYY-MM-DD")
+
+	if release.Certification != "" {
+		_, ok := certifications.Rank(release.Country, release.Certification)
+		v.Check(ok, "certification", "must be one of the certifications used in the country")
+	}
+}
+
+type ReleaseModel struct {
+	DB *sql.DB
+}
+
+// Certifications returns the table of certifications for every country.
+func (m ReleaseModel) Certifications() (Certifications, error) {
+	certs, err := m.GetAllCertifications()
+	if err != nil {
+		return nil, err
+	}
+
+	certifications := make(Certifications)
+
+	for _, cert := range certs {
+		if certifications[cert.Country] == nil {
+			certifications[cert.Country] = make(map[string]int)
+		}
+
+		certifications[cert.Country][cert.Code] = cert.Rank
+	}
+
+	return certifications, nil
+}
+
+// GetAllCertifications returns every certification, by country and then rank.
+func (m ReleaseModel) GetAllCertifications() ([]*Certification, error) {
+	query := `
+		SELECT country, code, rank, description
+		FROM certifications
+		ORDER BY country, rank`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	certs := []*Certification{}
+
+	for rows.Next() {
+		var cert Certification
+
+		err := rows.Scan(&cert.Country, &cert.Code, &cert.Rank, &cert.Description)
+		if err != nil {
+			return nil, err
+		}
+
+		certs = append(certs, &cert)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return certs, nil
+}
+
+// Upsert records the release of a movie in a country, replacing any existing release
+// there. It returns ErrRecordNotFound if the movie doesn't exist or is in the trash.
+func (m ReleaseModel) Upsert(release *Release) error {
+	query := `
+		INSERT INTO movie_releases (movie_id, country, release_date, certification)
+		SELECT id, $2, $3::date, NULLIF($4, '')
+		FROM movies
+		WHERE id = $1 AND deleted_at IS NULL
+		ON CONFLICT (movie_id, country) DO UPDATE
+		SET release_date = EXCLUDED.release_date, certification = EXCLUDED.certification`
+
+	args := []any{
+		release.MovieID,
+		release.Country,
+		release.ReleaseDate,
+		release.Certification,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (m ReleaseModel) Delete(movieID int64, country string) error {
+	query := `
+		DELETE FROM movie_releases
+		WHERE movie_id = $1 AND country = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, movieID, country)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// GetForMovie returns the releases of a movie, earliest first.
+func (m ReleaseModel) GetForMovie(movieID int64) ([]*Release, error) {
+	query := `
+		SELECT movie_id, country, to_char(release_date, 'YYYY-MM-DD'), coalesce(certification, '')
+		FROM movie_releases
+		WHERE movie_id = $1
+		ORDER BY release_date, country`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, movieID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	releases := []*Release{}
+
+	for rows.Next() {
+		var release Release
+
+		err := rows.Scan(&release.MovieID, &release.Country, &release.ReleaseDate, &release.Certification)
+		if err != nil {
+			return nil, err
+		}
+
+		releases = append(releases, &release)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return releases, nil
+}
@@ -0,0 +1,214 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// The operations which can create a movie revision.
+const (
+	RevisionInsert  = "insert"
+	RevisionUpdate  = "update"
+	RevisionDelete  = "delete"
+	RevisionRestore = "restore"
+)
+
+// MovieRevision is a snapshot of a movie as it was straight after a change, along
+// with what the change was and who made it.
+type MovieRevision struct {
+	MovieID   int64     `json:"movie_id"`
+	Version   int32     `json:"version"`
+	Operation string    `json:"operation"`
+	UserID    int64     `json:"user_id,omitzero"`
+	CreatedAt time.Time `json:"created_at"`
+	Title     string    `json:"title"`
+	Year      int32     `json:"year"`
+	Runtime   Runtime   `json:"runtime"`
+	Genres    []string  `json:"genres"`
+}
+
+// FieldChange describes how a single movie field differs between two revisions.
+type FieldChange struct {
+	Field string `json:"field"`
+	From  any    `json:"from"`
+	To    any    `json:"to"`
+}
+
+// DiffRevisions returns the fields which differ between two revisions of a movie.
+func DiffRevisions(from, to *MovieRevision) []FieldChange {
+	changes := []FieldChange{}
+
+	if from.Title != to.Title {
+		changes = append(changes, FieldChange{Field: "title", From: from.Title, To: to.Title})
+	}
+
+	if from.Year != to.Year {
+		changes = append(changes, FieldChange{Field: "year", From: from.Year, To: to.Year})
+	}
+
+	if from.Runtime != to.Runtime {
+		changes = append(changes, FieldChange{Field: "runtime", From: from.Runtime, To: to.Runtime})
+	}
+
+	if !slices.Equal(from.Genres, to.Genres) {
+		changes = append(changes, FieldChange{Field: "genres", From: from.Genres, To: to.Genres})
+	}
+
+	return changes
+}
+
+// insertRevision records the current state of a movie as a new revision. It's
+// called from within the transaction which made the change, so that the movie and
+// its history can never disagree. A userID of 0 records the change without a user.
+func insertRevision(ctx context.Context, tx *sql.Tx, movie *Movie, operation string, userID int64) error {
+	query := `
+		INSERT INTO movie_revisions (movie_id, version, operation, user_id, title, year, runtime, genres)
+		VALUES ($1, $2, $3, NULLIF($4, 0), $5, $6, $7, $8)`
+
+	args := []any{
+		movie.ID,
+		movie.Vesion,
+		operation,
+		userID,
+		movie.Title,
+		movie.Year,
+		movie.Runtime,
+		pq.Array(movie.Genres),
+	}
+
+	_, err := tx.ExecContext(ctx, query, args...)
+	return err
+}
+
+type RevisionModel struct {
+	DB *sql.DB
+}
+
+// Get returns a single revision of a movie. The history of a movie which isn't
+// published is only returned when includeUnpublished is true, the same as the movie
+// itself, while the history left behind by purged movies stays visible.
+func (m RevisionModel) Get(movieID int64, version int32, includeUnpublished bool) (*MovieRevision, error) {
+	query := `
+		SELECT movie_id, version, operation, COALESCE(user_id, 0), created_at, title, year, runtime, genres
+		FROM movie_revisions
+		WHERE movie_id = $1 AND version = $2
+		AND ($3 OR NOT EXISTS (
+			SELECT 1 FROM movies WHERE movies.id = movie_revisions.movie_id AND movies.status <> 'published'
+		))`
+
+	var revision MovieRevision
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, movieID, version, includeUnpublished).Scan(
+		&revision.MovieID,
+		&revision.Version,
+		&revision.Operation,
+		&revision.UserID,
+		&revision.CreatedAt,
+		&revision.Title,
+		&revision.Year,
+		&revision.Runtime,
+		pq.Array(&revision.Genres),
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &revision, nil
+}
+
+// GetPrevious returns the revision immediately before the given version, or
+// ErrRecordNotFound if it's the first one.
+func (m RevisionModel) GetPrevious(movieID int64, version int32, includeUnpublished bool) (*MovieRevision, error) {
+	query := `
+		SELECT version
+		FROM movie_revisions
+		WHERE movie_id = $1 AND version < $2
+		ORDER BY version DESC
+		LIMIT 1`
+
+	var previous int32
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, movieID, version).Scan(&previous)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return m.Get(movieID, previous, includeUnpublished)
+}
+
+// GetAllForMovie returns a page of a movie's revisions, newest first. Revisions of
+// unpublished movies are left out unless includeUnpublished is true, as for Get().
+func (m RevisionModel) GetAllForMovie(movieID int64, includeUnpublished bool, filters Filters) ([]*MovieRevision, Metadata, error) {
+	query := `
+		SELECT count(*) OVER(), movie_id, version, operation, COALESCE(user_id, 0), created_at, title, year, runtime, genres
+		FROM movie_revisions
+		WHERE movie_id = $1
+		AND ($4 OR NOT EXISTS (
+			SELECT 1 FROM movies WHERE movies.id = movie_revisions.movie_id AND movies.status <> 'published'
+		))
+		ORDER BY version DESC
+		LIMIT $2 OFFSET $3`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, movieID, filters.limit(), filters.offfset(), includeUnpublished)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	revisions := []*MovieRevision{}
+
+	for rows.Next() {
+		var revision MovieRevision
+
+		err := rows.Scan(
+			&totalRecords,
+			&revision.MovieID,
+			&revision.Version,
+			&revision.Operation,
+			&revision.UserID,
+			&revision.CreatedAt,
+			&revision.Title,
+			&revision.Year,
+			&revision.Runtime,
+			pq.Array(&revision.Genres),
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		revisions = append(revisions, &revision)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := CalculateMetaData(totalRecords, filters.Page, filters.PageSize, TotalExact)
+
+	return revisions, metadata, nil
+}
@@ -57,3 +57,17 @@ func (r *Runtime) UnmarshalJSON(jsonValue []byte) error {
 
 	return nil
 }
+
+// ParseRuntime parses a runtime given either in the "<runtime> mins" format used in
+// our JSON, or as a plain integer number of minutes.
+func ParseRuntime(s string) (Runtime, error) {
+	s = strings.TrimSpace(s)
+	s = strings.TrimSpace(strings.TrimSuffix(s, "mins"))
+
+	i, err := strconv.ParseInt(s, 10, 32)
+	if err != nil {
+		return 0, ErrInvalidRuntimeFormat
+	}
+
+	return Runtime(i), nil
+}
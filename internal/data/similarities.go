@@ -0,0 +1,295 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// How much each signal contributes to the similarity score of two movies. The
+// weights add up to one, so scores are always between zero and one.
+const (
+	similarityGenreWeight    = 0.5
+	similarityYearWeight     = 0.2
+	similarityTogetherWeight = 0.3
+)
+
+// similarityYearSpan is how many years apart two movies can be before their release
+// years stop counting towards their similarity.
+const similarityYearSpan = 20
+
+// similarMoviesKept is how many of the most similar movies are stored for each movie.
+const similarMoviesKept = 100
+
+// SimilarMovie is a movie returned as being similar to another one, along with how
+// similar it is.
+type SimilarMovie struct {
+	Movie
+	Score float64 `json:"score"`
+}
+
+type SimilarityModel struct {
+	DB *sql.DB
+}
+
+// GetSimilar returns the published movies which are most similar to the given one,
+// as of the last time its similarities were computed.
+func (m SimilarityModel) GetSimilar(movieID int64, filter Filters) ([]*SimilarMovie, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), movies.id, movies.created_at, movies.title, movies.year, movies.runtime, movies.genres, movies.version,
+			movie_similarities.score
+		FROM movie_similarities
+		INNER JOIN movies ON movies.id = movie_similarities.similar_movie_id
+		WHERE movie_similarities.movie_id = $1
+		AND movies.deleted_at IS NULL
+		AND movies.status = 'published'
+		ORDER BY %s %s, movies.id ASC
+		LIMIT $2 OFFSET $3`, filter.sortColumn(), filter.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, movieID, filter.limit(), filter.offfset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	movies := []*SimilarMovie{}
+
+	for rows.Next() {
+		var movie SimilarMovie
+
+		err := rows.Scan(
+			&totalRecords,
+			&movie.ID,
+			&movie.CreatedAt,
+			&movie.Title,
+			&movie.Year,
+			&movie.Runtime,
+			pq.Array(&movie.Genres),
+			&movie.Vesion,
+			&movie.Score,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		movies = append(movies, &movie)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := CalculateMetaData(totalRecords, filter.Page, filter.PageSize, TotalExact)
+
+	return movies, metadata, nil
+}
+
+// RecomputeQueued recomputes the similarities of up to limit of the movies which are
+// waiting in the queue, oldest first, and returns how many it recomputed. Movies are
+// queued by database triggers whenever their genres, year or trash status change, or
+// they're added to or removed from a watchlist or list.
+func (m SimilarityModel) RecomputeQueued(limit int) (int, error) {
+	for i := range limit {
+		done, err := m.recomputeNext()
+		if err != nil {
+			return i, err
+		}
+		if !done {
+			return i, nil
+		}
+	}
+
+	return limit, nil
+}
+
+// recomputeNext takes the oldest movie off the queue and recomputes its similarities.
+// It reports false if the queue was empty. Each movie is done in its own transaction,
+// so several instances of the application can work through the queue at once.
+func (m SimilarityModel) recomputeNext() (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		DELETE FROM movie_similarity_queue
+		WHERE movie_id = (
+			SELECT movie_id FROM movie_similarity_queue
+			ORDER BY queued_at, movie_id
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING movie_id`
+
+	var movieID int64
+
+	err = tx.QueryRowContext(ctx, query).Scan(&movieID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return false, nil
+		default:
+			return false, err
+		}
+	}
+
+	err = recomputeSimilarities(ctx, tx, movieID)
+	if err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+// recomputeSimilarities scores every other movie against the given one and stores the
+// most similar. A movie's score against another is the same both ways round, so the
+// other movies' stored scores for this one are brought up to date too; that way only
+// the movie which changed needs recomputing.
+func recomputeSimilarities(ctx context.Context, tx *sql.Tx, movieID int64) error {
+	// Two movies are seen together when the same user has both on their watchlist, or
+	// they're both on the same list. The count is scaled by the geometric mean of how
+	// many watchlists and lists each movie is on, which keeps the score the same both
+	// ways round and between 0 and 1.
+	query := `
+		WITH target AS (
+			SELECT id, year, genres
+			FROM movies
+			WHERE id = $1 AND deleted_at IS NULL
+		), seen_together AS (
+			SELECT movie_id, sum(shared) AS shared
+			FROM (
+				SELECT other.movie_id, count(*) AS shared
+				FROM watchlist AS this
+				INNER JOIN watchlist AS other ON other.user_id = this.user_id AND other.movie_id <> this.movie_id
+				WHERE this.movie_id = $1
+				GROUP BY other.movie_id
+				UNION ALL
+				SELECT other.movie_id, count(*) AS shared
+				FROM lists_movies AS this
+				INNER JOIN lists_movies AS other ON other.list_id = this.list_id AND other.movie_id <> this.movie_id
+				WHERE this.movie_id = $1
+				GROUP BY other.movie_id
+			) AS counts
+			GROUP BY movie_id
+		), appearances AS (
+			SELECT movie_id, count(*) AS n
+			FROM (
+				SELECT movie_id FROM watchlist
+				UNION ALL
+				SELECT movie_id FROM lists_movies
+			) AS entries
+			WHERE movie_id = $1 OR movie_id IN (SELECT movie_id FROM seen_together)
+			GROUP BY movie_id
+		)
+		SELECT movies.id,
+			$2 * coalesce(
+				cardinality(ARRAY(SELECT unnest(movies.genres) INTERSECT SELECT unnest(target.genres)))::double precision /
+				nullif(cardinality(ARRAY(SELECT unnest(movies.genres) UNION SELECT unnest(target.genres))), 0),
+			0) +
+			$3 * greatest(0, 1 - abs(movies.year - target.year)::double precision / $5) +
+			$4 * coalesce(seen_together.shared / nullif(sqrt(target_appearances.n * appearances.n), 0), 0) AS score
+		FROM movies
+		CROSS JOIN target
+		LEFT JOIN appearances AS target_appearances ON target_appearances.movie_id = target.id
+		LEFT JOIN seen_together ON seen_together.movie_id = movies.id
+		LEFT JOIN appearances ON appearances.movie_id = movies.id
+		WHERE movies.id <> target.id
+		AND movies.deleted_at IS NULL
+		AND (movies.genres && target.genres OR seen_together.movie_id IS NOT NULL)
+		ORDER BY score DESC, movies.id ASC`
+
+	rows, err := tx.QueryContext(ctx, query, movieID,
+		similarityGenreWeight, similarityYearWeight, similarityTogetherWeight, similarityYearSpan)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	// The slices mustn't be nil, as pq sends nil arrays as NULL.
+	ids := []int64{}
+	scores := []float64{}
+
+	for rows.Next() {
+		var (
+			id    int64
+			score float64
+		)
+
+		err := rows.Scan(&id, &score)
+		if err != nil {
+			return err
+		}
+
+		ids = append(ids, id)
+		scores = append(scores, score)
+	}
+
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	kept := min(len(ids), similarMoviesKept)
+
+	// Replace the movie's own list of similar movies with the best of the new scores.
+	_, err = tx.ExecContext(ctx, `DELETE FROM movie_similarities WHERE movie_id = $1`, movieID)
+	if err != nil {
+		return err
+	}
+
+	query = `
+		INSERT INTO movie_similarities (movie_id, similar_movie_id, score)
+		SELECT $1, scored.id, scored.score
+		FROM unnest($2::bigint[], $3::double precision[]) AS scored(id, score)`
+
+	_, err = tx.ExecContext(ctx, query, movieID, pq.Array(ids[:kept]), pq.Array(scores[:kept]))
+	if err != nil {
+		return err
+	}
+
+	// Other movies no longer hold on to this one if it's stopped being similar to
+	// them at all, and update their score for it if it still is.
+	query = `
+		DELETE FROM movie_similarities
+		WHERE similar_movie_id = $1
+		AND NOT movie_id = ANY($2)`
+
+	_, err = tx.ExecContext(ctx, query, movieID, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+
+	query = `
+		UPDATE movie_similarities
+		SET score = scored.score, computed_at = NOW()
+		FROM unnest($2::bigint[], $3::double precision[]) AS scored(id, score)
+		WHERE movie_similarities.movie_id = scored.id
+		AND movie_similarities.similar_movie_id = $1`
+
+	_, err = tx.ExecContext(ctx, query, movieID, pq.Array(ids), pq.Array(scores))
+	if err != nil {
+		return err
+	}
+
+	// The movies which this one is most similar to also get it added to their lists,
+	// as it's likely to be among their most similar too.
+	query = `
+		INSERT INTO movie_similarities (movie_id, similar_movie_id, score)
+		SELECT scored.id, $1, scored.score
+		FROM unnest($2::bigint[], $3::double precision[]) AS scored(id, score)
+		ON CONFLICT (movie_id, similar_movie_id) DO NOTHING`
+
+	_, err = tx.ExecContext(ctx, query, movieID, pq.Array(ids[:kept]), pq.Array(scores[:kept]))
+	return err
+}
@@ -0,0 +1,271 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/markponce/greenlight/internal/validator"
+)
+
+var ErrSubmissionReviewed = errors.New("submission already reviewed")
+
+// The states a submission goes through. Every submission starts out pending, and is
+// then either approved or rejected by a moderator.
+const (
+	SubmissionPending  = "pending"
+	SubmissionApproved = "approved"
+	SubmissionRejected = "rejected"
+)
+
+// Submission is a new movie or an edit to an existing one, proposed by a user who
+// can't change movies themselves. Kind is either OperationCreate or OperationUpdate.
+// Movie is the movie as it would be once the submission is approved; for edits its ID
+// is the movie being edited and its version the one the edit was proposed against.
+type Submission struct {
+	ID         int64      `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UserID     int64      `json:"user_id"`
+	Kind       string     `json:"kind"`
+	Movie      *Movie     `json:"movie"`
+	Status     string     `json:"status"`
+	Reason     string     `json:"reason,omitempty"`
+	ReviewerID int64      `json:"reviewer_id,omitzero"`
+	ReviewedAt *time.Time `json:"reviewed_at,omitempty"`
+	// UserEmail is the submitter's email address, for notifying them once the
+	// submission has been reviewed.
+	UserEmail string `json:"-"`
+}
+
+func ValidateRejection(v *validator.Validator, reason string) {
+	v.Check(reason != "", "reason", "must be provided")
+	v.Check(len(reason) <= 1000, "reason", "must not be more than 1000 bytes long")
+}
+
+type SubmissionModel struct {
+	DB *sql.DB
+}
+
+// Insert adds a submission to the moderation queue.
+func (m SubmissionModel) Insert(s *Submission) error {
+	query := `
+		INSERT INTO movie_submissions (user_id, kind, movie_id, movie_version, title, year, runtime, genres)
+		VALUES ($1, $2, NULLIF($3, 0), $4, $5, $6, $7, $8)
+		RETURNING id, created_at, status`
+
+	args := []any{
+		s.UserID,
+		s.Kind,
+		s.Movie.ID,
+		s.Movie.Vesion,
+		s.Movie.Title,
+		s.Movie.Year,
+		s.Movie.Runtime,
+		pq.Array(s.Movie.Genres),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&s.ID, &s.CreatedAt, &s.Status)
+}
+
+// submissionColumns are the columns scanned by scanSubmission().
+const submissionColumns = `
+	movie_submissions.id, movie_submissions.created_at, movie_submissions.user_id, users.email,
+	movie_submissions.kind, COALESCE(movie_submissions.movie_id, 0), movie_submissions.movie_version,
+	movie_submissions.title, movie_submissions.year, movie_submissions.runtime, movie_submissions.genres,
+	movie_submissions.status, movie_submissions.reason, COALESCE(movie_submissions.reviewer_id, 0),
+	movie_submissions.reviewed_at`
+
+// scanSubmission scans a row selecting submissionColumns, with any columns before
+// them scanned into dest.
+func scanSubmission(row interface{ Scan(...any) error }, dest ...any) (*Submission, error) {
+	s := Submission{Movie: &Movie{}}
+
+	dest = append(dest,
+		&s.ID,
+		&s.CreatedAt,
+		&s.UserID,
+		&s.UserEmail,
+		&s.Kind,
+		&s.Movie.ID,
+		&s.Movie.Vesion,
+		&s.Movie.Title,
+		&s.Movie.Year,
+		&s.Movie.Runtime,
+		pq.Array(&s.Movie.Genres),
+		&s.Status,
+		&s.Reason,
+		&s.ReviewerID,
+		&s.ReviewedAt,
+	)
+
+	err := row.Scan(dest...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+func (m SubmissionModel) Get(id int64) (*Submission, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT ` + submissionColumns + `
+		FROM movie_submissions
+		INNER JOIN users ON users.id = movie_submissions.user_id
+		WHERE movie_submissions.id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	s, err := scanSubmission(m.DB.QueryRowContext(ctx, query, id))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+// GetAll returns a page of submissions, optionally narrowed down to those made by a
+// user (when userID is non-zero) or to those with a status.
+func (m SubmissionModel) GetAll(userID int64, status string, filters Filters) ([]*Submission, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), `+submissionColumns+`
+		FROM movie_submissions
+		INNER JOIN users ON users.id = movie_submissions.user_id
+		WHERE (movie_submissions.user_id = $1 OR $1 = 0)
+		AND (movie_submissions.status = $2 OR $2 = '')
+		ORDER BY movie_submissions.%s %s, movie_submissions.id ASC
+		LIMIT $3 OFFSET $4`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, status, filters.limit(), filters.offfset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	submissions := []*Submission{}
+
+	for rows.Next() {
+		s, err := scanSubmission(rows, &totalRecords)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		submissions = append(submissions, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := CalculateMetaData(totalRecords, filters.Page, filters.PageSize, TotalExact)
+
+	return submissions, metadata, nil
+}
+
+// Approve accepts a pending submission, saving s.Movie as a new movie or as an
+// update to the existing one. The movie's revision is recorded against the
+// moderator, who saved it and may have changed it first, so they show up in the
+// movie's history like any other editor; the submitter is kept on the submission,
+// which is linked to the movie. Any changes the moderator made to s.Movie are saved
+// with the submission. For edits, s.Movie must be at the movie's current version,
+// and ErrEditConflict is returned if it has changed since. ErrSubmissionReviewed is
+// returned if the submission is no longer pending.
+func (m SubmissionModel) Approve(s *Submission, reviewerID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	movies := MovieModel{DB: m.DB}
+
+	switch s.Kind {
+	case OperationCreate:
+		err = movies.insertTx(ctx, tx, s.Movie, reviewerID)
+	default:
+		err = movies.updateTx(ctx, tx, s.Movie, reviewerID)
+	}
+	if err != nil {
+		return err
+	}
+
+	query := `
+		UPDATE movie_submissions
+		SET status = 'approved', movie_id = $2, title = $3, year = $4, runtime = $5, genres = $6,
+			reviewer_id = $7, reviewed_at = NOW()
+		WHERE id = $1 AND status = 'pending'
+		RETURNING status, reviewed_at`
+
+	args := []any{
+		s.ID,
+		s.Movie.ID,
+		s.Movie.Title,
+		s.Movie.Year,
+		s.Movie.Runtime,
+		pq.Array(s.Movie.Genres),
+		reviewerID,
+	}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&s.Status, &s.ReviewedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrSubmissionReviewed
+		default:
+			return err
+		}
+	}
+
+	s.ReviewerID = reviewerID
+
+	return tx.Commit()
+}
+
+// Reject turns down a pending submission, giving the reason to pass on to the
+// submitter. It returns ErrSubmissionReviewed if the submission is no longer pending.
+func (m SubmissionModel) Reject(s *Submission, reason string, reviewerID int64) error {
+	query := `
+		UPDATE movie_submissions
+		SET status = 'rejected', reason = $2, reviewer_id = $3, reviewed_at = NOW()
+		WHERE id = $1 AND status = 'pending'
+		RETURNING status, reason, reviewed_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, s.ID, reason, reviewerID).Scan(&s.Status, &s.Reason, &s.ReviewedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrSubmissionReviewed
+		default:
+			return err
+		}
+	}
+
+	s.ReviewerID = reviewerID
+
+	return nil
+}
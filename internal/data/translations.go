@@ -0,0 +1,242 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/markponce/greenlight/internal/validator"
+	"golang.org/x/text/language"
+)
+
+// searchConfigs maps the languages which Postgres has a text search configuration for
+// to the name of the configuration. Titles in any other language are searched with
+// the "simple" configuration, which doesn't do any stemming.
+var searchConfigs = map[string]string{
+	"da": "danish",
+	"de": "german",
+	"en": "english",
+	"es": "spanish",
+	"fi": "finnish",
+	"fr": "french",
+	"hu": "hungarian",
+	"it": "italian",
+	"nb": "norwegian",
+	"nl": "dutch",
+	"no": "norwegian",
+	"pt": "portuguese",
+	"ro": "romanian",
+	"ru": "russian",
+	"sv": "swedish",
+	"tr": "turkish",
+}
+
+// Translation is the title and synopsis of a movie in a given locale, which is a
+// BCP 47 language tag like "fr" or "pt-BR".
+type Translation struct {
+	MovieID   int64     `json:"-"`
+	Locale    string    `json:"locale"`
+	Title     string    `json:"title"`
+	Synopsis  string    `json:"synopsis,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// CanonicalLocale parses a language tag and returns it in its canonical form, so that
+// "PT-br" becomes "pt-BR".
+func CanonicalLocale(s string) (string, bool) {
+	tag, err := language.Parse(s)
+	if err != nil || tag == language.Und {
+		return "", false
+	}
+
+	return tag.String(), true
+}
+
+// searchConfig returns the text search configuration to use for titles in a locale.
+func searchConfig(locale string) string {
+	tag, err := language.Parse(locale)
+	if err != nil {
+		return "simple"
+	}
+
+	base, _ := tag.Base()
+
+	if config, ok := searchConfigs[base.String()]; ok {
+		return config
+	}
+
+	return "simple"
+}
+
+func ValidateTranslation(v *validator.Validator, t *Translation) {
+	_, ok := CanonicalLocale(t.Locale)
+	v.Check(ok, "locale", "must be a valid language tag")
+
+	v.Check(t.Title != "", "title", "must be provided")
+	v.Check(len(t.Title) <= 500, "title", "must not be more than 500 bytes long")
+	v.Check(len(t.Synopsis) <= 10_000, "synopsis", "must not be more than 10000 bytes long")
+}
+
+type TranslationModel struct {
+	DB *sql.DB
+}
+
+// Upsert adds a translation of a movie, or replaces the existing one for the same
+// locale. Like images, translations are part of the movie's representation, so the
+// movie's version is incremented too.
+func (m TranslationModel) Upsert(t *Translation, userID int64) error {
+	query := `
+		INSERT INTO movie_translations (movie_id, locale, title, synopsis, search_config)
+		VALUES ($1, $2, $3, $4, $5::regconfig)
+		ON CONFLICT (movie_id, locale) DO UPDATE
+		SET title = EXCLUDED.title, synopsis = EXCLUDED.synopsis, updated_at = NOW()
+		RETURNING updated_at`
+
+	args := []any{
+		t.MovieID,
+		t.Locale,
+		t.Title,
+		t.Synopsis,
+		searchConfig(t.Locale),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = bumpMovieVersion(ctx, tx, t.MovieID, userID)
+	if err != nil {
+		return err
+	}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&t.UpdatedAt)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Delete removes a movie's translation for a locale, incrementing the movie's version
+// as Upsert() does.
+func (m TranslationModel) Delete(movieID int64, locale string, userID int64) error {
+	query := `
+		DELETE FROM movie_translations
+		WHERE movie_id = $1 AND locale = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, query, movieID, locale)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	err = bumpMovieVersion(ctx, tx, movieID, userID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetForMovie returns all of a movie's translations, ordered by locale.
+func (m TranslationModel) GetForMovie(movieID int64) ([]*Translation, error) {
+	query := `
+		SELECT movie_id, locale, title, synopsis, updated_at
+		FROM movie_translations
+		WHERE movie_id = $1
+		ORDER BY locale`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, movieID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	translations := []*Translation{}
+
+	for rows.Next() {
+		var t Translation
+
+		err := rows.Scan(&t.MovieID, &t.Locale, &t.Title, &t.Synopsis, &t.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		translations = append(translations, &t)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return translations, nil
+}
+
+// GetBestForMovies returns, for each of the given movies, its translation in the
+// first of the locales which it has one for, keyed by movie ID. Movies without a
+// translation in any of the locales are left out.
+func (m TranslationModel) GetBestForMovies(movieIDs []int64, locales []string) (map[int64]*Translation, error) {
+	query := `
+		SELECT DISTINCT ON (movie_translations.movie_id)
+			movie_translations.movie_id, movie_translations.locale, movie_translations.title,
+			movie_translations.synopsis, movie_translations.updated_at
+		FROM movie_translations
+		INNER JOIN unnest($2::text[]) WITH ORDINALITY AS preferred(locale, rank)
+			ON preferred.locale = movie_translations.locale
+		WHERE movie_translations.movie_id = ANY($1)
+		ORDER BY movie_translations.movie_id, preferred.rank`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(movieIDs), pq.Array(locales))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	translations := make(map[int64]*Translation)
+
+	for rows.Next() {
+		var t Translation
+
+		err := rows.Scan(&t.MovieID, &t.Locale, &t.Title, &t.Synopsis, &t.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		translations[t.MovieID] = &t
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return translations, nil
+}
@@ -0,0 +1,251 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// errors specific to watchlists
+var (
+	ErrDuplicateWatchlistEntry = errors.New("duplicate watchlist entry")
+)
+
+// WatchlistEntry is a movie saved by a user, along with whether (and when) they
+// have watched it and whether they've marked it as a favorite.
+type WatchlistEntry struct {
+	UserID    int64      `json:"-"`
+	Movie     *Movie     `json:"movie"`
+	AddedAt   time.Time  `json:"added_at"`
+	Watched   bool       `json:"watched"`
+	WatchedAt *time.Time `json:"watched_at,omitempty"`
+	Favorite  bool       `json:"favorite"`
+}
+
+type WatchlistModel struct {
+	DB *sql.DB
+}
+
+// Insert adds a movie to a user's watchlist. It returns ErrRecordNotFound if the
+// movie doesn't exist, is in the trash, or is unpublished and includeUnpublished
+// isn't set.
+func (m WatchlistModel) Insert(entry *WatchlistEntry, includeUnpublished bool) error {
+	query := `
+		INSERT INTO watchlist (user_id, movie_id, favorite)
+		SELECT $1, id, $3 FROM movies
+		WHERE id = $2 AND deleted_at IS NULL AND (status = 'published' OR $4)
+		RETURNING added_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, entry.UserID, entry.Movie.ID, entry.Favorite, includeUnpublished).Scan(&entry.AddedAt)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "watchlist_pkey"`:
+			return ErrDuplicateWatchlistEntry
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m WatchlistModel) Get(userID, movieID int64) (*WatchlistEntry, error) {
+	query := `
+		SELECT movies.id, movies.created_at, movies.title, movies.year, movies.runtime, movies.genres, movies.version,
+			watchlist.added_at, watchlist.watched_at, watchlist.favorite
+		FROM watchlist
+		INNER JOIN movies ON movies.id = watchlist.movie_id
+		WHERE watchlist.user_id = $1 AND watchlist.movie_id = $2 AND movies.deleted_at IS NULL`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	entry, err := scanWatchlistEntry(m.DB.QueryRowContext(ctx, query, userID, movieID))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	entry.UserID = userID
+
+	return entry, nil
+}
+
+// Update saves the watched state and favorite flag of an entry. Marking an
+// already watched movie as watched again keeps the original watched_at time.
+func (m WatchlistModel) Update(entry *WatchlistEntry) error {
+	query := `
+		UPDATE watchlist
+		SET watched_at = CASE WHEN $1 THEN COALESCE(watched_at, NOW()) END, favorite = $2
+		WHERE user_id = $3 AND movie_id = $4
+		RETURNING watched_at`
+
+	args := []any{
+		entry.Watched,
+		entry.Favorite,
+		entry.UserID,
+		entry.Movie.ID,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&entry.WatchedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m WatchlistModel) Delete(userID, movieID int64) error {
+	query := `
+		DELETE FROM watchlist
+		WHERE user_id = $1 AND movie_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, userID, movieID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// GetAll returns a page of a user's watchlist. The movies can be narrowed down with
+// the same criteria as MovieModel.GetAll, and optionally by their watched state and
+// favorite flag, where a nil value means that the condition isn't applied.
+func (m WatchlistModel) GetAll(userID int64, criteria MovieCriteria, watched, favorite *bool, filter Filters) ([]*WatchlistEntry, Metadata, error) {
+	conditions, args := criteria.where()
+	args = append(args, userID, watched, favorite, filter.limit(), filter.offfset())
+
+	n := len(args)
+
+	query := fmt.Sprintf(`
+	SELECT count(*) OVER(), movies.id, movies.created_at, movies.title, movies.year, movies.runtime, movies.genres, movies.version,
+		watchlist.added_at, watchlist.watched_at, watchlist.favorite
+	FROM watchlist
+	INNER JOIN movies ON movies.id = watchlist.movie_id
+	WHERE %s
+	AND watchlist.user_id = $%d
+	AND ($%d::boolean IS NULL OR (watchlist.watched_at IS NOT NULL) = $%d)
+	AND ($%d::boolean IS NULL OR watchlist.favorite = $%d)
+	ORDER BY %s %s, movies.id ASC
+	LIMIT $%d OFFSET $%d`,
+		conditions,
+		n-4,
+		n-3, n-3,
+		n-2, n-2,
+		filter.sortColumn(),
+		filter.sortDirection(),
+		n-1,
+		n,
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	entries := []*WatchlistEntry{}
+
+	for rows.Next() {
+		var (
+			entry WatchlistEntry
+			movie Movie
+		)
+
+		err := rows.Scan(
+			&totalRecords,
+			&movie.ID,
+			&movie.CreatedAt,
+			&movie.Title,
+			&movie.Year,
+			&movie.Runtime,
+			pq.Array(&movie.Genres),
+			&movie.Vesion,
+			&entry.AddedAt,
+			&entry.WatchedAt,
+			&entry.Favorite,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		entry.UserID = userID
+		entry.Movie = &movie
+		entry.Watched = entry.WatchedAt != nil
+
+		entries = append(entries, &entry)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := CalculateMetaData(totalRecords, filter.Page, filter.PageSize, TotalExact)
+
+	return entries, metadata, nil
+}
+
+func scanWatchlistEntry(row *sql.Row) (*WatchlistEntry, error) {
+	var (
+		entry WatchlistEntry
+		movie Movie
+	)
+
+	err := row.Scan(
+		&movie.ID,
+		&movie.CreatedAt,
+		&movie.Title,
+		&movie.Year,
+		&movie.Runtime,
+		pq.Array(&movie.Genres),
+		&movie.Vesion,
+		&entry.AddedAt,
+		&entry.WatchedAt,
+		&entry.Favorite,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	entry.Movie = &movie
+	entry.Watched = entry.WatchedAt != nil
+
+	return &entry, nil
+}
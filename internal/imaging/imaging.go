@@ -0,0 +1,126 @@
+// Package imaging decodes uploaded images and makes thumbnails of them, using only
+// the standard library's image packages.
+package imaging
+
+import (
+	"errors"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"io"
+
+	// Register the GIF and PNG decoders with image.Decode(). JPEG is registered by
+	// the import above.
+	_ "image/gif"
+	_ "image/png"
+)
+
+// Limits on the images accepted, so that a small file can't decode into an image
+// large enough to exhaust the server's memory.
+const (
+	MaxDimension = 10_000
+	MaxPixels    = 50_000_000
+)
+
+// ErrTooLarge is returned by Decode() for images beyond the limits above.
+var ErrTooLarge = errors.New("image dimensions are too large")
+
+// Decode reads an image, checking its dimensions from the header before decoding the
+// rest of it. The reader must be positioned at the start of the image and be
+// seekable, since it's read twice.
+func Decode(r io.ReadSeeker) (image.Image, error) {
+	config, _, err := image.DecodeConfig(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.Width > MaxDimension || config.Height > MaxDimension || config.Width*config.Height > MaxPixels {
+		return nil, ErrTooLarge
+	}
+
+	_, err = r.Seek(0, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+
+	img, _, err := image.Decode(r)
+	return img, err
+}
+
+// RGBA converts an image to RGBA with its origin at (0, 0), which is the form
+// Thumbnail() works from. Converting is as costly as a full pass over the image, so
+// when several thumbnails are made of the same image it should only be done once.
+func RGBA(src image.Image) *image.RGBA {
+	if rgba, ok := src.(*image.RGBA); ok && rgba.Rect.Min == (image.Point{}) {
+		return rgba
+	}
+
+	bounds := src.Bounds()
+
+	rgba := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), src, bounds.Min, draw.Src)
+
+	return rgba
+}
+
+// Thumbnail scales an image down to the given width, keeping its aspect ratio. Each
+// thumbnail pixel is the average of the pixels it covers in the source, which gives
+// good results for the large reductions thumbnails need. The source is read directly
+// rather than through the slower image.Image interface, so it must come from RGBA().
+// Images which are already no wider than width are returned as they are rather than
+// being enlarged.
+func Thumbnail(rgba *image.RGBA, width int) *image.RGBA {
+	sw, sh := rgba.Rect.Dx(), rgba.Rect.Dy()
+
+	if sw <= width || sw == 0 || sh == 0 {
+		return rgba
+	}
+
+	dw := width
+	dh := max(1, sh*width/sw)
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+
+	for dy := range dh {
+		y0 := dy * sh / dh
+		y1 := max(y0+1, (dy+1)*sh/dh)
+
+		for dx := range dw {
+			x0 := dx * sw / dw
+			x1 := max(x0+1, (dx+1)*sw/dw)
+
+			var r, g, b, a, n int
+
+			for y := y0; y < y1; y++ {
+				row := rgba.Pix[y*rgba.Stride:]
+
+				for x := x0; x < x1; x++ {
+					p := row[x*4 : x*4+4]
+					r += int(p[0])
+					g += int(p[1])
+					b += int(p[2])
+					a += int(p[3])
+					n++
+				}
+			}
+
+			i := dy*dst.Stride + dx*4
+			dst.Pix[i] = uint8(r / n)
+			dst.Pix[i+1] = uint8(g / n)
+			dst.Pix[i+2] = uint8(b / n)
+			dst.Pix[i+3] = uint8(a / n)
+		}
+	}
+
+	return dst
+}
+
+// EncodeJPEG writes an image as a JPEG, which is the format all thumbnails are saved
+// in. Transparent areas are flattened onto white, since JPEG has no alpha channel.
+func EncodeJPEG(w io.Writer, img *image.RGBA) error {
+	flat := image.NewRGBA(img.Bounds())
+	draw.Draw(flat, flat.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(flat, flat.Bounds(), img, img.Bounds().Min, draw.Over)
+
+	return jpeg.Encode(w, flat, &jpeg.Options{Quality: 85})
+}
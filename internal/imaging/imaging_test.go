@@ -0,0 +1,193 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// encodePNG returns an image encoded as a PNG.
+func encodePNG(t *testing.T, img image.Image) *bytes.Reader {
+	t.Helper()
+
+	var buf bytes.Buffer
+
+	err := png.Encode(&buf, img)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return bytes.NewReader(buf.Bytes())
+}
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name          string
+		width, height int
+		want          error
+	}{
+		{name: "small", width: 40, height: 30},
+		{name: "widest allowed", width: MaxDimension, height: 1},
+		{name: "too wide", width: MaxDimension + 1, height: 1, want: ErrTooLarge},
+		{name: "too high", width: 1, height: MaxDimension + 1, want: ErrTooLarge},
+		{name: "too many pixels", width: 8000, height: 8000, want: ErrTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var r *bytes.Reader
+
+			// The limits are checked before the image is decoded, so the oversized
+			// images only need a header.
+			if tt.want == nil {
+				r = encodePNG(t, image.NewGray(image.Rect(0, 0, tt.width, tt.height)))
+			} else {
+				r = bytes.NewReader(pngHeader(tt.width, tt.height))
+			}
+
+			img, err := Decode(r)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("got error %v; want %v", err, tt.want)
+			}
+
+			if err == nil && (img.Bounds().Dx() != tt.width || img.Bounds().Dy() != tt.height) {
+				t.Errorf("got %v; want %dx%d", img.Bounds(), tt.width, tt.height)
+			}
+		})
+	}
+}
+
+// pngHeader returns the start of a PNG file of the given dimensions, which is
+// enough for image.DecodeConfig() but not for decoding the image itself.
+func pngHeader(width, height int) []byte {
+	var buf bytes.Buffer
+
+	small := image.NewGray(image.Rect(0, 0, 1, 1))
+	_ = png.Encode(&buf, small)
+
+	b := buf.Bytes()
+
+	// The width and height are the first two fields of the 13 byte IHDR chunk,
+	// which follows the 8 byte signature and the chunk's length and type. The
+	// chunk's CRC, which covers its type and data, has to be updated to match.
+	binary.BigEndian.PutUint32(b[16:], uint32(width))
+	binary.BigEndian.PutUint32(b[20:], uint32(height))
+	binary.BigEndian.PutUint32(b[29:], crc32.ChecksumIEEE(b[12:29]))
+
+	return b
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	_, err := Decode(bytes.NewReader([]byte("not an image")))
+	if err == nil {
+		t.Error("got no error for an invalid image")
+	}
+}
+
+func TestRGBA(t *testing.T) {
+	tests := []struct {
+		name string
+		src  image.Image
+	}{
+		{name: "gray", src: image.NewGray(image.Rect(0, 0, 4, 3))},
+		{name: "rgba", src: image.NewRGBA(image.Rect(0, 0, 4, 3))},
+		{name: "offset origin", src: image.NewRGBA(image.Rect(10, 20, 14, 23))},
+		{name: "sub-image", src: image.NewNRGBA(image.Rect(0, 0, 10, 10)).SubImage(image.Rect(2, 3, 6, 6))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := RGBA(tt.src)
+
+			if got.Rect != image.Rect(0, 0, 4, 3) {
+				t.Errorf("got bounds %v; want (0,0)-(4,3)", got.Rect)
+			}
+		})
+	}
+
+	// An RGBA image which is already at the origin is used as it is.
+	src := image.NewRGBA(image.Rect(0, 0, 4, 3))
+	if RGBA(src) != src {
+		t.Error("got a copy of an RGBA image already at the origin")
+	}
+}
+
+func TestThumbnail(t *testing.T) {
+	tests := []struct {
+		name          string
+		width, height int
+		thumbWidth    int
+		wantW, wantH  int
+	}{
+		{name: "landscape", width: 400, height: 200, thumbWidth: 100, wantW: 100, wantH: 50},
+		{name: "portrait", width: 200, height: 300, thumbWidth: 160, wantW: 160, wantH: 240},
+		{name: "uneven", width: 333, height: 111, thumbWidth: 100, wantW: 100, wantH: 33},
+		{name: "very wide", width: 1000, height: 1, thumbWidth: 100, wantW: 100, wantH: 1},
+		{name: "already small", width: 80, height: 60, thumbWidth: 160, wantW: 80, wantH: 60},
+		{name: "exact width", width: 160, height: 90, thumbWidth: 160, wantW: 160, wantH: 90},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := RGBA(image.NewGray(image.Rect(0, 0, tt.width, tt.height)))
+
+			got := Thumbnail(src, tt.thumbWidth)
+
+			if got.Bounds().Dx() != tt.wantW || got.Bounds().Dy() != tt.wantH {
+				t.Errorf("got %dx%d; want %dx%d", got.Bounds().Dx(), got.Bounds().Dy(), tt.wantW, tt.wantH)
+			}
+		})
+	}
+}
+
+func TestThumbnailAverages(t *testing.T) {
+	// A checkerboard of black and opaque white squares averages out to mid gray.
+	src := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	for y := range 4 {
+		for x := range 4 {
+			if (x+y)%2 == 0 {
+				src.Set(x, y, color.White)
+			} else {
+				src.Set(x, y, color.Black)
+			}
+		}
+	}
+
+	got := Thumbnail(src, 2)
+
+	for y := range 2 {
+		for x := range 2 {
+			if c := got.RGBAAt(x, y); c != (color.RGBA{127, 127, 127, 255}) {
+				t.Errorf("pixel (%d, %d): got %v; want mid gray", x, y, c)
+			}
+		}
+	}
+}
+
+func TestEncodeJPEG(t *testing.T) {
+	// Transparent pixels are flattened onto white, as JPEG has no alpha channel.
+	src := image.NewRGBA(image.Rect(0, 0, 8, 8))
+
+	var buf bytes.Buffer
+
+	err := EncodeJPEG(&buf, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := jpeg.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, g, b, _ := img.At(4, 4).RGBA()
+	if r>>8 < 250 || g>>8 < 250 || b>>8 < 250 {
+		t.Errorf("got color (%d, %d, %d); want white", r>>8, g>>8, b>>8)
+	}
+}
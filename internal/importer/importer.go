@@ -0,0 +1,461 @@
+// Package importer reads movies from CSV or NDJSON catalog dumps, validates them and
+// inserts them into the database in batches. It's shared by the import endpoint in
+// cmd/api and the import subcommand in cmd/cli.
+package importer
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/markponce/greenlight/internal/data"
+	"github.com/markponce/greenlight/internal/validator"
+)
+
+// Supported input formats.
+const (
+	FormatCSV    = "csv"
+	FormatNDJSON = "ndjson"
+)
+
+// ErrInvalidInput is wrapped around any error caused by the input being unreadable,
+// as opposed to a failure writing to the database.
+var ErrInvalidInput = errors.New("invalid input")
+
+// maxReportedErrors caps the number of row errors kept in a report, so that a
+// completely broken file can't use up an unbounded amount of memory. Every failed row
+// is still counted.
+const maxReportedErrors = 1000
+
+// fields are the movie fields that can be imported.
+var fields = []string{"title", "year", "runtime", "genres"}
+
+// Options controls how an import is run.
+type Options struct {
+	// Format is either FormatCSV or FormatNDJSON.
+	Format string
+	// Columns maps movie fields to the names of the CSV columns or NDJSON keys
+	// holding them. Fields which aren't mapped are read from the column or key with
+	// the same name as the field.
+	Columns map[string]string
+	// DryRun validates every row without writing anything to the database.
+	DryRun bool
+	// Upsert updates existing movies which match by title and year, instead of
+	// inserting duplicates of them.
+	Upsert bool
+	// BatchSize is the number of movies inserted per statement.
+	BatchSize int
+	// UserID is the user the new revisions are recorded against.
+	UserID int64
+	// Taxonomy is used to check genres and map their aliases to slugs. If it's nil,
+	// genres aren't checked against the taxonomy.
+	Taxonomy data.Taxonomy
+}
+
+// RowError holds the problems with a single row of the input. Row is the line
+// number that the row starts on.
+type RowError struct {
+	Row    int               `json:"row"`
+	Errors map[string]string `json:"errors"`
+}
+
+// Report summarizes the outcome of an import. Batches counts the batches written to
+// the database. If the import fails partway through, StoppedAt is the line number
+// of the first row which wasn't written: every valid row before it has been
+// committed, so the import can be resumed from there.
+type Report struct {
+	DryRun    bool       `json:"dry_run"`
+	Rows      int        `json:"rows"`
+	Valid     int        `json:"valid"`
+	Failed    int        `json:"failed"`
+	Inserted  int        `json:"inserted"`
+	Updated   int        `json:"updated"`
+	Batches   int        `json:"batches"`
+	StoppedAt int        `json:"stopped_at,omitzero"`
+	Errors    []RowError `json:"errors"`
+}
+
+func (rep *Report) addError(row int, errs map[string]string) {
+	rep.Failed++
+
+	if len(rep.Errors) < maxReportedErrors {
+		rep.Errors = append(rep.Errors, RowError{Row: row, Errors: errs})
+	}
+}
+
+// ParseColumns parses a column mapping in the form "title=Name,year=Released" into a
+// map from movie field to column name.
+func ParseColumns(s string) (map[string]string, error) {
+	columns := make(map[string]string)
+
+	if s == "" {
+		return columns, nil
+	}
+
+	for _, pair := range strings.Split(s, ",") {
+		field, column, ok := strings.Cut(pair, "=")
+		field = strings.TrimSpace(field)
+		column = strings.TrimSpace(column)
+
+		if !ok || column == "" || !validator.PermittedValue(field, fields...) {
+			return nil, fmt.Errorf("invalid column mapping %q", pair)
+		}
+
+		columns[field] = column
+	}
+
+	return columns, nil
+}
+
+// ValidateOptions checks the options given by the client.
+func ValidateOptions(v *validator.Validator, opts Options) {
+	v.Check(validator.PermittedValue(opts.Format, FormatCSV, FormatNDJSON), "format", "must be either csv or ndjson")
+	v.Check(opts.BatchSize > 0, "batch_size", "must be greater than zero")
+	v.Check(opts.BatchSize <= 1000, "batch_size", "must be a maximum of 1000")
+}
+
+// record is a single row of input, holding the raw text of each movie field.
+type record struct {
+	row    int
+	values map[string]string
+}
+
+// reader returns the rows of the input one at a time, returning io.EOF once there
+// are no more.
+type reader interface {
+	next() (*record, error)
+}
+
+// Run reads every row from r, validating each one and inserting the valid ones in
+// batches, unless this is a dry run. Rows which fail validation are skipped and
+// listed in the report. If reading the input or writing to the database fails
+// partway through, the report so far is returned along with the error; movies from
+// batches that were already written stay in the database, and the report's
+// StoppedAt says where to pick up from.
+func Run(r io.Reader, movies *data.MovieModel, opts Options) (*Report, error) {
+	report := &Report{DryRun: opts.DryRun, Errors: []RowError{}}
+
+	var (
+		rd  reader
+		err error
+	)
+
+	switch opts.Format {
+	case FormatCSV:
+		rd, err = newCSVReader(r, opts.Columns)
+	case FormatNDJSON:
+		rd = newNDJSONReader(r, opts.Columns)
+	default:
+		err = fmt.Errorf("unsupported format %q", opts.Format)
+	}
+	if err != nil {
+		return report, fmt.Errorf("%w: %w", ErrInvalidInput, err)
+	}
+
+	batch := make([]*data.Movie, 0, opts.BatchSize)
+
+	// batchStart is the line the current batch starts on, and lastRow the line of
+	// the last row read, for working out where a failed import stopped.
+	var batchStart, lastRow int
+
+	// stop records where the import stopped: at the start of the batch which is yet
+	// to be written, or else just after the last row read.
+	stop := func() {
+		report.StoppedAt = lastRow + 1
+		if len(batch) > 0 {
+			report.StoppedAt = batchStart
+		}
+	}
+
+	flush := func() error {
+		if opts.DryRun || len(batch) == 0 {
+			batch = batch[:0]
+			return nil
+		}
+
+		inserted, updated, err := movies.InsertBatch(batch, opts.Upsert, opts.UserID)
+		if err != nil {
+			stop()
+			return err
+		}
+
+		report.Inserted += inserted
+		report.Updated += updated
+		report.Batches++
+		batch = batch[:0]
+
+		return nil
+	}
+
+	// In upsert mode, the same title and year appearing twice would make the batch
+	// ambiguous, so later occurrences are rejected.
+	seen := make(map[string]int)
+
+	for {
+		rec, err := rd.next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		var rowErr *rowError
+		if errors.As(err, &rowErr) {
+			report.Rows++
+			lastRow = rowErr.row
+			report.addError(rowErr.row, map[string]string{"row": rowErr.message})
+			continue
+		}
+
+		if err != nil {
+			stop()
+			return report, fmt.Errorf("%w: %w", ErrInvalidInput, err)
+		}
+
+		report.Rows++
+		lastRow = rec.row
+
+		movie, errs := convert(rec, opts.Taxonomy)
+		if errs != nil {
+			report.addError(rec.row, errs)
+			continue
+		}
+
+		if opts.Upsert {
+			key := strings.ToLower(movie.Title) + "\x00" + strconv.Itoa(int(movie.Year))
+
+			if first, ok := seen[key]; ok {
+				report.addError(rec.row, map[string]string{"title": fmt.Sprintf("duplicates the movie on row %d", first)})
+				continue
+			}
+
+			seen[key] = rec.row
+		}
+
+		report.Valid++
+
+		if len(batch) == 0 {
+			batchStart = rec.row
+		}
+		batch = append(batch, movie)
+
+		if len(batch) >= opts.BatchSize {
+			err = flush()
+			if err != nil {
+				return report, err
+			}
+		}
+	}
+
+	return report, flush()
+}
+
+// convert turns a record into a movie, returning the validation errors if it isn't
+// a valid one.
+func convert(rec *record, taxonomy data.Taxonomy) (*data.Movie, map[string]string) {
+	v := validator.New()
+
+	movie := &data.Movie{
+		Title: strings.TrimSpace(rec.values["title"]),
+	}
+
+	if s := strings.TrimSpace(rec.values["year"]); s != "" {
+		year, err := strconv.ParseInt(s, 10, 32)
+		if err != nil {
+			v.AddError("year", "must be an integer value")
+		}
+		movie.Year = int32(year)
+	}
+
+	if s := strings.TrimSpace(rec.values["runtime"]); s != "" {
+		runtime, err := data.ParseRuntime(s)
+		if err != nil {
+			v.AddError("runtime", `must be a number of minutes, like "107 mins" or 107`)
+		}
+		movie.Runtime = runtime
+	}
+
+	// Genres are separated by commas or pipes, with any surrounding whitespace
+	// ignored.
+	if s := rec.values["genres"]; strings.TrimSpace(s) != "" {
+		movie.Genres = strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == '|' })
+
+		for i := range movie.Genres {
+			movie.Genres[i] = strings.TrimSpace(movie.Genres[i])
+		}
+	}
+
+	if data.ValidateMovie(v, movie, taxonomy); !v.Valid() {
+		return nil, v.Errors
+	}
+
+	return movie, nil
+}
+
+// rowError reports a row which couldn't be read at all, as opposed to one which was
+// read but isn't a valid movie. The import carries on past it.
+type rowError struct {
+	row     int
+	message string
+}
+
+func (e *rowError) Error() string {
+	return fmt.Sprintf("row %d: %s", e.row, e.message)
+}
+
+// columnFor returns the column holding a field, taking the mapping into account.
+func columnFor(columns map[string]string, field string) string {
+	if column, ok := columns[field]; ok {
+		return column
+	}
+
+	return field
+}
+
+type csvReader struct {
+	r       *csv.Reader
+	indexes map[string]int
+}
+
+// newCSVReader reads the header row and works out which column holds each field.
+// Column names are matched without regard to case.
+func newCSVReader(r io.Reader, columns map[string]string) (*csvReader, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.ReuseRecord = true
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("missing header row")
+		}
+		return nil, err
+	}
+
+	indexes := make(map[string]int)
+
+	for _, field := range fields {
+		column := columnFor(columns, field)
+
+		for i, name := range header {
+			if strings.EqualFold(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")), column) {
+				indexes[field] = i
+				break
+			}
+		}
+	}
+
+	if _, ok := indexes["title"]; !ok {
+		return nil, fmt.Errorf("missing %q column in header row", columnFor(columns, "title"))
+	}
+
+	return &csvReader{r: cr, indexes: indexes}, nil
+}
+
+func (cr *csvReader) next() (*record, error) {
+	values, err := cr.r.Read()
+	if err != nil {
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			return nil, &rowError{row: parseErr.StartLine, message: parseErr.Err.Error()}
+		}
+		return nil, err
+	}
+
+	line, _ := cr.r.FieldPos(0)
+
+	rec := &record{row: line, values: make(map[string]string, len(cr.indexes))}
+
+	for field, i := range cr.indexes {
+		if i < len(values) {
+			rec.values[field] = values[i]
+		}
+	}
+
+	return rec, nil
+}
+
+type ndjsonReader struct {
+	scanner *bufio.Scanner
+	columns map[string]string
+	line    int
+}
+
+func newNDJSONReader(r io.Reader, columns map[string]string) *ndjsonReader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1_048_576)
+
+	return &ndjsonReader{scanner: scanner, columns: columns}
+}
+
+func (nr *ndjsonReader) next() (*record, error) {
+	for nr.scanner.Scan() {
+		nr.line++
+
+		line := strings.TrimSpace(nr.scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		var object map[string]json.RawMessage
+
+		err := json.Unmarshal([]byte(line), &object)
+		if err != nil {
+			return nil, &rowError{row: nr.line, message: "must be a JSON object"}
+		}
+
+		rec := &record{row: nr.line, values: make(map[string]string, len(fields))}
+
+		for _, field := range fields {
+			raw, ok := object[columnFor(nr.columns, field)]
+			if !ok {
+				continue
+			}
+
+			value, err := rawText(raw)
+			if err != nil {
+				return nil, &rowError{row: nr.line, message: fmt.Sprintf("%s must be a string, number or array of strings", field)}
+			}
+
+			rec.values[field] = value
+		}
+
+		return rec, nil
+	}
+
+	if err := nr.scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return nil, io.EOF
+}
+
+// rawText converts a JSON value into the same text that would appear in a CSV
+// column. Arrays of strings are joined with pipes, so that genres can be given
+// either as an array or as a single string.
+func rawText(raw json.RawMessage) (string, error) {
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s, nil
+	}
+
+	var n json.Number
+	if err := json.Unmarshal(raw, &n); err == nil {
+		return n.String(), nil
+	}
+
+	var list []string
+	if err := json.Unmarshal(raw, &list); err == nil {
+		return strings.Join(list, "|"), nil
+	}
+
+	if string(raw) == "null" {
+		return "", nil
+	}
+
+	return "", errors.New("unsupported JSON value")
+}
@@ -0,0 +1,268 @@
+package importer
+
+import (
+	"errors"
+	"maps"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/markponce/greenlight/internal/data"
+)
+
+func TestParseColumns(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    map[string]string
+		wantErr bool
+	}{
+		{input: "", want: map[string]string{}},
+		{input: "title=Name", want: map[string]string{"title": "Name"}},
+		{input: "title=Name, year = Released", want: map[string]string{"title": "Name", "year": "Released"}},
+		{input: "genres=Genre List", want: map[string]string{"genres": "Genre List"}},
+		{input: "title", wantErr: true},
+		{input: "title=", wantErr: true},
+		{input: "director=Director", wantErr: true},
+		{input: "title=Name,", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseColumns(tt.input)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got %v; want an error", got)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !maps.Equal(got, tt.want) {
+				t.Errorf("got %v; want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestRun runs imports as dry runs, which validate every row without needing a
+// database.
+func TestRun(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    Options
+		input   string
+		rows    int
+		valid   int
+		errRows []int
+	}{
+		{
+			name: "csv",
+			opts: Options{Format: FormatCSV},
+			input: "title,year,runtime,genres\n" +
+				"Casablanca,1942,102 mins,drama|romance\n" +
+				"The Breakfast Club,1985,97,\"comedy, drama\"\n",
+			rows:  2,
+			valid: 2,
+		},
+		{
+			name: "csv header in any case and order",
+			opts: Options{Format: FormatCSV},
+			input: "\ufeffGenres, Runtime, Title, Year\n" +
+				"drama,102,Casablanca,1942\n",
+			rows:  1,
+			valid: 1,
+		},
+		{
+			name: "csv column mapping",
+			opts: Options{Format: FormatCSV, Columns: map[string]string{"title": "Name", "year": "Released"}},
+			input: "Name,Released,runtime,genres\n" +
+				"Casablanca,1942,102,drama\n",
+			rows:  1,
+			valid: 1,
+		},
+		{
+			name: "csv invalid rows are skipped",
+			opts: Options{Format: FormatCSV},
+			input: "title,year,runtime,genres\n" +
+				"Casablanca,1942,102,drama\n" +
+				",1942,102,drama\n" +
+				"Metropolis,nineteen,153,sci-fi\n" +
+				"Nosferatu,1922,94 minutes,horror\n" +
+				"Alien,1979,117,\n",
+			rows:    5,
+			valid:   1,
+			errRows: []int{3, 4, 5, 6},
+		},
+		{
+			name: "csv unreadable row",
+			opts: Options{Format: FormatCSV},
+			input: "title,year,runtime,genres\n" +
+				"\"Casablanca,1942,102,drama\n",
+			rows:    1,
+			errRows: []int{2},
+		},
+		{
+			name: "ndjson",
+			opts: Options{Format: FormatNDJSON},
+			input: `{"title":"Casablanca","year":1942,"runtime":"102 mins","genres":["drama","romance"]}` + "\n" +
+				"\n" +
+				`{"title":"Alien","year":"1979","runtime":117,"genres":"sci-fi|horror"}` + "\n",
+			rows:  2,
+			valid: 2,
+		},
+		{
+			name: "ndjson key mapping",
+			opts: Options{Format: FormatNDJSON, Columns: map[string]string{"title": "name"}},
+			input: `{"name":"Casablanca","year":1942,"runtime":102,"genres":["drama"]}` + "\n" +
+				`{"title":"Alien","year":1979,"runtime":117,"genres":["sci-fi"]}` + "\n",
+			rows:    2,
+			valid:   1,
+			errRows: []int{2},
+		},
+		{
+			name: "ndjson unreadable rows",
+			opts: Options{Format: FormatNDJSON},
+			input: `["Casablanca"]` + "\n" +
+				`{"title":{"en":"Alien"},"year":1979,"runtime":117,"genres":["sci-fi"]}` + "\n" +
+				`{"title":"Alien","year":1979,"runtime":117,"genres":["sci-fi"]}` + "\n",
+			rows:    3,
+			valid:   1,
+			errRows: []int{1, 2},
+		},
+		{
+			name: "upsert rejects repeated movies",
+			opts: Options{Format: FormatCSV, Upsert: true},
+			input: "title,year,runtime,genres\n" +
+				"Casablanca,1942,102,drama\n" +
+				"CASABLANCA,1942,102,romance\n" +
+				"Casablanca,1943,102,drama\n",
+			rows:    3,
+			valid:   2,
+			errRows: []int{3},
+		},
+		{
+			name: "unknown genres are rejected with a taxonomy",
+			opts: Options{Format: FormatCSV, Taxonomy: data.Taxonomy{"drama": "drama", "sci-fi": "sci-fi", "science fiction": "sci-fi"}},
+			input: "title,year,runtime,genres\n" +
+				"Alien,1979,117,Science Fiction\n" +
+				"Casablanca,1942,102,romance\n",
+			rows:    2,
+			valid:   1,
+			errRows: []int{3},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.DryRun = true
+			tt.opts.BatchSize = 100
+
+			report, err := Run(strings.NewReader(tt.input), nil, tt.opts)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if report.Rows != tt.rows || report.Valid != tt.valid || report.Failed != len(tt.errRows) {
+				t.Errorf("got %d rows, %d valid and %d failed; want %d, %d and %d",
+					report.Rows, report.Valid, report.Failed, tt.rows, tt.valid, len(tt.errRows))
+			}
+
+			var errRows []int
+			for _, rowErr := range report.Errors {
+				errRows = append(errRows, rowErr.Row)
+			}
+
+			if !reflect.DeepEqual(errRows, tt.errRows) {
+				t.Errorf("got errors on rows %v; want %v", errRows, tt.errRows)
+			}
+
+			if report.Inserted != 0 || report.Updated != 0 {
+				t.Errorf("dry run reported %d inserted and %d updated", report.Inserted, report.Updated)
+			}
+		})
+	}
+}
+
+func TestRunInvalidInput(t *testing.T) {
+	tests := []struct {
+		name  string
+		opts  Options
+		input string
+	}{
+		{name: "empty csv", opts: Options{Format: FormatCSV}, input: ""},
+		{name: "csv without title column", opts: Options{Format: FormatCSV}, input: "name,year\nCasablanca,1942\n"},
+		{name: "csv with unmapped title column", opts: Options{Format: FormatCSV, Columns: map[string]string{"title": "Name"}}, input: "title,year\nCasablanca,1942\n"},
+		{name: "ndjson line too long", opts: Options{Format: FormatNDJSON}, input: `{"title":"` + strings.Repeat("a", 2_000_000) + `"}`},
+		{name: "unknown format", opts: Options{Format: "xml"}, input: "<movies/>"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.DryRun = true
+			tt.opts.BatchSize = 100
+
+			_, err := Run(strings.NewReader(tt.input), nil, tt.opts)
+			if !errors.Is(err, ErrInvalidInput) {
+				t.Errorf("got error %v; want %v", err, ErrInvalidInput)
+			}
+		})
+	}
+}
+
+func TestConvert(t *testing.T) {
+	taxonomy := data.Taxonomy{"drama": "drama", "sci-fi": "sci-fi", "science fiction": "sci-fi"}
+
+	rec := &record{
+		row: 2,
+		values: map[string]string{
+			"title":   "  Alien ",
+			"year":    " 1979",
+			"runtime": "117 mins",
+			"genres":  " Science Fiction | drama ",
+		},
+	}
+
+	movie, errs := convert(rec, taxonomy)
+	if errs != nil {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+
+	want := &data.Movie{Title: "Alien", Year: 1979, Runtime: 117, Genres: []string{"sci-fi", "drama"}}
+
+	if !reflect.DeepEqual(movie, want) {
+		t.Errorf("got %+v; want %+v", movie, want)
+	}
+}
+
+func TestRunStoppedAt(t *testing.T) {
+	valid := `{"title":"Alien","year":1979,"runtime":117,"genres":["sci-fi"]}` + "\n"
+	tooLong := `{"title":"` + strings.Repeat("a", 2_000_000) + `"}`
+
+	tests := []struct {
+		name      string
+		batchSize int
+		input     string
+		want      int
+	}{
+		{name: "nothing read", batchSize: 2, input: tooLong, want: 1},
+		{name: "within the first batch", batchSize: 2, input: valid + tooLong, want: 1},
+		{name: "after a full batch", batchSize: 2, input: valid + valid + valid + tooLong, want: 3},
+		{name: "after a failed row", batchSize: 2, input: valid + valid + `["Alien"]` + "\n" + tooLong, want: 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report, err := Run(strings.NewReader(tt.input), nil, Options{Format: FormatNDJSON, DryRun: true, BatchSize: tt.batchSize})
+			if !errors.Is(err, ErrInvalidInput) {
+				t.Fatalf("got error %v; want %v", err, ErrInvalidInput)
+			}
+
+			if report.StoppedAt != tt.want {
+				t.Errorf("got stopped at %d; want %d", report.StoppedAt, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,374 @@
+package jsonpatch
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// assertJSONEqual fails the test if got and want aren't the same JSON value, ignoring
+// differences in formatting and member order.
+func assertJSONEqual(t *testing.T, got []byte, want string) {
+	t.Helper()
+
+	var g, w any
+
+	if err := json.Unmarshal(got, &g); err != nil {
+		t.Fatalf("unmarshalling result %s: %v", got, err)
+	}
+
+	if err := json.Unmarshal([]byte(want), &w); err != nil {
+		t.Fatalf("unmarshalling expected %s: %v", want, err)
+	}
+
+	if !reflect.DeepEqual(g, w) {
+		t.Errorf("got %s; want %s", got, want)
+	}
+}
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name  string
+		doc   string
+		patch string
+		want  string
+	}{
+		// The examples from appendix A of RFC 6902.
+		{
+			name:  "A.1 adding an object member",
+			doc:   `{"foo": "bar"}`,
+			patch: `[{"op": "add", "path": "/baz", "value": "qux"}]`,
+			want:  `{"baz": "qux", "foo": "bar"}`,
+		},
+		{
+			name:  "A.2 adding an array element",
+			doc:   `{"foo": ["bar", "baz"]}`,
+			patch: `[{"op": "add", "path": "/foo/1", "value": "qux"}]`,
+			want:  `{"foo": ["bar", "qux", "baz"]}`,
+		},
+		{
+			name:  "A.3 removing an object member",
+			doc:   `{"baz": "qux", "foo": "bar"}`,
+			patch: `[{"op": "remove", "path": "/baz"}]`,
+			want:  `{"foo": "bar"}`,
+		},
+		{
+			name:  "A.4 removing an array element",
+			doc:   `{"foo": ["bar", "qux", "baz"]}`,
+			patch: `[{"op": "remove", "path": "/foo/1"}]`,
+			want:  `{"foo": ["bar", "baz"]}`,
+		},
+		{
+			name:  "A.5 replacing a value",
+			doc:   `{"baz": "qux", "foo": "bar"}`,
+			patch: `[{"op": "replace", "path": "/baz", "value": "boo"}]`,
+			want:  `{"baz": "boo", "foo": "bar"}`,
+		},
+		{
+			name:  "A.6 moving a value",
+			doc:   `{"foo": {"bar": "baz", "waldo": "fred"}, "qux": {"corge": "grault"}}`,
+			patch: `[{"op": "move", "from": "/foo/waldo", "path": "/qux/thud"}]`,
+			want:  `{"foo": {"bar": "baz"}, "qux": {"corge": "grault", "thud": "fred"}}`,
+		},
+		{
+			name:  "A.7 moving an array element",
+			doc:   `{"foo": ["all", "grass", "cows", "eat"]}`,
+			patch: `[{"op": "move", "from": "/foo/1", "path": "/foo/3"}]`,
+			want:  `{"foo": ["all", "cows", "eat", "grass"]}`,
+		},
+		{
+			name: "A.8 testing a value: success",
+			doc:  `{"baz": "qux", "foo": ["a", 2, "c"]}`,
+			patch: `[
+				{"op": "test", "path": "/baz", "value": "qux"},
+				{"op": "test", "path": "/foo/1", "value": 2}
+			]`,
+			want: `{"baz": "qux", "foo": ["a", 2, "c"]}`,
+		},
+		{
+			name:  "A.10 adding a nested member object",
+			doc:   `{"foo": "bar"}`,
+			patch: `[{"op": "add", "path": "/child", "value": {"grandchild": {}}}]`,
+			want:  `{"foo": "bar", "child": {"grandchild": {}}}`,
+		},
+		{
+			name:  "A.11 ignoring unrecognized elements",
+			doc:   `{"foo": "bar"}`,
+			patch: `[{"op": "add", "path": "/baz", "value": "qux", "xyz": 123}]`,
+			want:  `{"foo": "bar", "baz": "qux"}`,
+		},
+		{
+			name: "A.14 ~ escape ordering",
+			doc:  `{"/": 9, "~1": 10}`,
+			patch: `[
+				{"op": "test", "path": "/~01", "value": 10}
+			]`,
+			want: `{"/": 9, "~1": 10}`,
+		},
+		{
+			name:  "A.16 adding an array value",
+			doc:   `{"foo": ["bar"]}`,
+			patch: `[{"op": "add", "path": "/foo/-", "value": ["abc", "def"]}]`,
+			want:  `{"foo": ["bar", ["abc", "def"]]}`,
+		},
+
+		// Pointer escaping.
+		{
+			name:  "escaped slash",
+			doc:   `{"a/b": 1}`,
+			patch: `[{"op": "replace", "path": "/a~1b", "value": 2}]`,
+			want:  `{"a/b": 2}`,
+		},
+		{
+			name:  "escaped tilde",
+			doc:   `{"m~n": 1}`,
+			patch: `[{"op": "remove", "path": "/m~0n"}]`,
+			want:  `{}`,
+		},
+		{
+			name:  "empty member name",
+			doc:   `{"": 1}`,
+			patch: `[{"op": "replace", "path": "/", "value": 2}]`,
+			want:  `{"": 2}`,
+		},
+		{
+			name:  "whole document",
+			doc:   `{"foo": "bar"}`,
+			patch: `[{"op": "replace", "path": "", "value": [1, 2]}]`,
+			want:  `[1, 2]`,
+		},
+
+		// The "-" index.
+		{
+			name:  "add to the end of an empty array",
+			doc:   `{"genres": []}`,
+			patch: `[{"op": "add", "path": "/genres/-", "value": "drama"}]`,
+			want:  `{"genres": ["drama"]}`,
+		},
+		{
+			name:  "move to the end of an array",
+			doc:   `{"genres": ["drama", "comedy", "horror"]}`,
+			patch: `[{"op": "move", "from": "/genres/0", "path": "/genres/-"}]`,
+			want:  `{"genres": ["comedy", "horror", "drama"]}`,
+		},
+		{
+			name:  "copy to the end of an array",
+			doc:   `{"genres": ["drama"], "extra": ["comedy"]}`,
+			patch: `[{"op": "copy", "from": "/extra/0", "path": "/genres/-"}]`,
+			want:  `{"genres": ["drama", "comedy"], "extra": ["comedy"]}`,
+		},
+
+		// Moving a value onto itself is allowed, as it's not a proper prefix.
+		{
+			name:  "move onto itself",
+			doc:   `{"foo": {"bar": 1}}`,
+			patch: `[{"op": "move", "from": "/foo", "path": "/foo"}]`,
+			want:  `{"foo": {"bar": 1}}`,
+		},
+		{
+			name:  "move to a sibling with a longer name",
+			doc:   `{"a": 1}`,
+			patch: `[{"op": "move", "from": "/a", "path": "/ab"}]`,
+			want:  `{"ab": 1}`,
+		},
+		{
+			name: "copy is independent of the original",
+			doc:  `{"a": {"b": 1}}`,
+			patch: `[
+				{"op": "copy", "from": "/a", "path": "/c"},
+				{"op": "replace", "path": "/c/b", "value": 2}
+			]`,
+			want: `{"a": {"b": 1}, "c": {"b": 2}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Apply([]byte(tt.doc), []byte(tt.patch))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			assertJSONEqual(t, got, tt.want)
+		})
+	}
+}
+
+func TestApplyErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		doc   string
+		patch string
+		want  error
+	}{
+		// The error examples from appendix A of RFC 6902.
+		{
+			name:  "A.9 testing a value: error",
+			doc:   `{"baz": "qux"}`,
+			patch: `[{"op": "test", "path": "/baz", "value": "bar"}]`,
+			want:  ErrTestFailed,
+		},
+		{
+			name:  "A.12 adding to a nonexistent target",
+			doc:   `{"foo": "bar"}`,
+			patch: `[{"op": "add", "path": "/baz/bat", "value": "qux"}]`,
+			want:  ErrInvalidPatch,
+		},
+		{
+			name:  "A.15 comparing strings and numbers",
+			doc:   `{"/": 9, "~1": 10}`,
+			patch: `[{"op": "test", "path": "/~01", "value": "10"}]`,
+			want:  ErrTestFailed,
+		},
+
+		// Moving a value into one of its own children.
+		{
+			name:  "move into child",
+			doc:   `{"foo": {"bar": 1}}`,
+			patch: `[{"op": "move", "from": "/foo", "path": "/foo/bar/baz"}]`,
+			want:  ErrInvalidPatch,
+		},
+		{
+			name:  "move into array element",
+			doc:   `{"foo": [1, 2]}`,
+			patch: `[{"op": "move", "from": "/foo", "path": "/foo/-"}]`,
+			want:  ErrInvalidPatch,
+		},
+
+		// The "-" index only refers to a position when inserting.
+		{
+			name:  "remove with -",
+			doc:   `{"foo": [1, 2]}`,
+			patch: `[{"op": "remove", "path": "/foo/-"}]`,
+			want:  ErrInvalidPatch,
+		},
+		{
+			name:  "replace with -",
+			doc:   `{"foo": [1, 2]}`,
+			patch: `[{"op": "replace", "path": "/foo/-", "value": 3}]`,
+			want:  ErrInvalidPatch,
+		},
+		{
+			name:  "test with -",
+			doc:   `{"foo": [1, 2]}`,
+			patch: `[{"op": "test", "path": "/foo/-", "value": 2}]`,
+			want:  ErrInvalidPatch,
+		},
+
+		// Malformed array indexes and pointers.
+		{
+			name:  "leading zero",
+			doc:   `{"foo": [1, 2]}`,
+			patch: `[{"op": "replace", "path": "/foo/01", "value": 3}]`,
+			want:  ErrInvalidPatch,
+		},
+		{
+			name:  "negative index",
+			doc:   `{"foo": [1, 2]}`,
+			patch: `[{"op": "remove", "path": "/foo/-1"}]`,
+			want:  ErrInvalidPatch,
+		},
+		{
+			name:  "index past the end",
+			doc:   `{"foo": [1, 2]}`,
+			patch: `[{"op": "add", "path": "/foo/3", "value": 3}]`,
+			want:  ErrInvalidPatch,
+		},
+		{
+			name:  "path without leading slash",
+			doc:   `{"foo": 1}`,
+			patch: `[{"op": "remove", "path": "foo"}]`,
+			want:  ErrInvalidPatch,
+		},
+
+		// Malformed operations.
+		{
+			name:  "unknown operation",
+			doc:   `{"foo": 1}`,
+			patch: `[{"op": "increment", "path": "/foo"}]`,
+			want:  ErrInvalidPatch,
+		},
+		{
+			name:  "missing path",
+			doc:   `{"foo": 1}`,
+			patch: `[{"op": "remove"}]`,
+			want:  ErrInvalidPatch,
+		},
+		{
+			name:  "missing value",
+			doc:   `{"foo": 1}`,
+			patch: `[{"op": "add", "path": "/bar"}]`,
+			want:  ErrInvalidPatch,
+		},
+		{
+			name:  "missing from",
+			doc:   `{"foo": 1}`,
+			patch: `[{"op": "copy", "path": "/bar"}]`,
+			want:  ErrInvalidPatch,
+		},
+		{
+			name:  "not an array",
+			doc:   `{"foo": 1}`,
+			patch: `{"op": "remove", "path": "/foo"}`,
+			want:  ErrInvalidPatch,
+		},
+		{
+			name:  "replace a missing member",
+			doc:   `{"foo": 1}`,
+			patch: `[{"op": "replace", "path": "/bar", "value": 2}]`,
+			want:  ErrInvalidPatch,
+		},
+		{
+			name:  "remove the whole document",
+			doc:   `{"foo": 1}`,
+			patch: `[{"op": "remove", "path": ""}]`,
+			want:  ErrInvalidPatch,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Apply([]byte(tt.doc), []byte(tt.patch))
+			if !errors.Is(err, tt.want) {
+				t.Errorf("got error %v; want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergePatch(t *testing.T) {
+	// The examples from appendix A of RFC 7396.
+	tests := []struct {
+		doc   string
+		patch string
+		want  string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"a":"foo"}`, `"bar"`, `"bar"`},
+		{`{"e":null}`, `{"a":1}`, `{"e":null,"a":1}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.patch, func(t *testing.T) {
+			got, err := MergePatch([]byte(tt.doc), []byte(tt.patch))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			assertJSONEqual(t, got, tt.want)
+		})
+	}
+}
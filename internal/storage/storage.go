@@ -0,0 +1,134 @@
+// Package storage saves uploaded files, such as movie images, and works out the URLs
+// they can be fetched from. Files are identified by keys, which are slash-separated
+// paths like "movies/12/poster.jpg".
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ErrInvalidKey is returned for keys which are empty or would escape the storage
+// area, such as ones containing "..".
+var ErrInvalidKey = errors.New("invalid storage key")
+
+// Storage is implemented by each place files can be kept. Only the local filesystem
+// is supported for now, but the interface is kept small enough that an S3-compatible
+// implementation can be added later.
+type Storage interface {
+	// Put saves the contents of r under key, replacing any existing file.
+	Put(ctx context.Context, key string, r io.Reader, contentType string) error
+	// Delete removes the file saved under key. Deleting a file which doesn't exist
+	// isn't an error.
+	Delete(ctx context.Context, key string) error
+	// URL returns the address that the file saved under key can be fetched from.
+	URL(key string) string
+}
+
+// Local keeps files in a directory on the local filesystem. They're served by the
+// handler returned from Handler(), which should be mounted at baseURL.
+type Local struct {
+	dir     string
+	baseURL string
+}
+
+// NewLocal returns a Local storage which keeps files under dir, creating it if
+// necessary, and whose files are served from baseURL.
+func NewLocal(dir, baseURL string) (*Local, error) {
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Local{dir: dir, baseURL: strings.TrimSuffix(baseURL, "/")}, nil
+}
+
+// path returns the filesystem path for a key.
+func (l *Local) path(key string) (string, error) {
+	if key == "" || !path.IsAbs("/"+key) || path.Clean("/"+key) != "/"+key {
+		return "", ErrInvalidKey
+	}
+
+	return filepath.Join(l.dir, filepath.FromSlash(key)), nil
+}
+
+// Put writes the file to a temporary name first and then renames it into place, so
+// that a half-written file is never served.
+func (l *Local) Put(ctx context.Context, key string, r io.Reader, contentType string) error {
+	name, err := l.path(key)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(name), 0o755)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(name), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	_, err = io.Copy(f, r)
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+
+	if err = ctx.Err(); err != nil {
+		return err
+	}
+
+	err = os.Chmod(f.Name(), 0o644)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), name)
+}
+
+func (l *Local) Delete(ctx context.Context, key string) error {
+	name, err := l.path(key)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(name)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+func (l *Local) URL(key string) string {
+	return l.baseURL + "/" + key
+}
+
+// Handler serves the stored files, with the URL path relative to baseURL used as the
+// key. Directory listings aren't served.
+func (l *Local) Handler() http.Handler {
+	fs := http.FileServer(http.Dir(l.dir))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/") || strings.Contains(path.Base(r.URL.Path), ".upload-") {
+			http.NotFound(w, r)
+			return
+		}
+
+		fs.ServeHTTP(w, r)
+	})
+}
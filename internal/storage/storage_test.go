@@ -0,0 +1,211 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newTestLocal(t *testing.T) *Local {
+	t.Helper()
+
+	l, err := NewLocal(t.TempDir(), "http://localhost:4000/media/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return l
+}
+
+func TestLocalPath(t *testing.T) {
+	l := newTestLocal(t)
+
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{key: "poster.jpg", want: "poster.jpg"},
+		{key: "movies/12/poster.jpg", want: filepath.Join("movies", "12", "poster.jpg")},
+		{key: "movies/12/poster..jpg", want: filepath.Join("movies", "12", "poster..jpg")},
+		{key: "movies/...", want: filepath.Join("movies", "...")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			got, err := l.path(tt.key)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if want := filepath.Join(l.dir, tt.want); got != want {
+				t.Errorf("got %q; want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestLocalPathInvalid(t *testing.T) {
+	l := newTestLocal(t)
+
+	tests := []string{
+		"",
+		".",
+		"..",
+		"../secret",
+		"../../etc/passwd",
+		"movies/../../secret",
+		"movies/12/../../../secret",
+		"movies/..",
+		"/etc/passwd",
+		"//etc/passwd",
+		"movies//poster.jpg",
+		"movies/./poster.jpg",
+		"./poster.jpg",
+		"movies/12/",
+	}
+
+	for _, key := range tests {
+		t.Run(key, func(t *testing.T) {
+			got, err := l.path(key)
+			if !errors.Is(err, ErrInvalidKey) {
+				t.Errorf("got %q, %v; want %v", got, err, ErrInvalidKey)
+			}
+		})
+	}
+}
+
+func TestLocalPutDelete(t *testing.T) {
+	l := newTestLocal(t)
+	ctx := context.Background()
+
+	key := "movies/12/poster.jpg"
+
+	err := l.Put(ctx, key, strings.NewReader("first"), "image/jpeg")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Putting a file again replaces it.
+	err = l.Put(ctx, key, strings.NewReader("second"), "image/jpeg")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	name := filepath.Join(l.dir, "movies", "12", "poster.jpg")
+
+	contents, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(contents) != "second" {
+		t.Errorf("got contents %q; want %q", contents, "second")
+	}
+
+	// No temporary files are left behind.
+	entries, err := os.ReadDir(filepath.Dir(name))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 1 {
+		t.Errorf("got %d files in the directory; want 1", len(entries))
+	}
+
+	err = l.Delete(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(name); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("file still exists after delete: %v", err)
+	}
+
+	// Deleting a file which doesn't exist isn't an error.
+	err = l.Delete(ctx, key)
+	if err != nil {
+		t.Errorf("unexpected error deleting a missing file: %v", err)
+	}
+}
+
+func TestLocalRejectsInvalidKeys(t *testing.T) {
+	l := newTestLocal(t)
+	ctx := context.Background()
+
+	err := l.Put(ctx, "../escaped.jpg", strings.NewReader("data"), "image/jpeg")
+	if !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("Put: got %v; want %v", err, ErrInvalidKey)
+	}
+
+	if _, err := os.Stat(filepath.Join(filepath.Dir(l.dir), "escaped.jpg")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("file was written outside the storage directory: %v", err)
+	}
+
+	err = l.Delete(ctx, "../escaped.jpg")
+	if !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("Delete: got %v; want %v", err, ErrInvalidKey)
+	}
+}
+
+func TestLocalURL(t *testing.T) {
+	l := newTestLocal(t)
+
+	if got, want := l.URL("movies/12/poster.jpg"), "http://localhost:4000/media/movies/12/poster.jpg"; got != want {
+		t.Errorf("got %q; want %q", got, want)
+	}
+}
+
+func TestLocalHandler(t *testing.T) {
+	l := newTestLocal(t)
+
+	err := l.Put(context.Background(), "movies/12/poster.jpg", strings.NewReader("poster"), "image/jpeg")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.WriteFile(filepath.Join(l.dir, "movies", "12", ".upload-123"), []byte("partial"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path   string
+		status int
+		body   string
+	}{
+		{path: "/movies/12/poster.jpg", status: http.StatusOK, body: "poster"},
+		{path: "/movies/12/missing.jpg", status: http.StatusNotFound},
+		{path: "/movies/12/", status: http.StatusNotFound},
+		{path: "/movies/12/.upload-123", status: http.StatusNotFound},
+		{path: "/../secret", status: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.URL.Path = tt.path
+
+			l.Handler().ServeHTTP(rr, r)
+
+			res := rr.Result()
+
+			if res.StatusCode != tt.status {
+				t.Errorf("got status %d; want %d", res.StatusCode, tt.status)
+			}
+
+			if tt.body != "" {
+				body, _ := io.ReadAll(res.Body)
+				if string(body) != tt.body {
+					t.Errorf("got body %q; want %q", body, tt.body)
+				}
+			}
+		})
+	}
+}
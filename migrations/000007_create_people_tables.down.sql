@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS movies_people;
+DROP TABLE IF EXISTS people;
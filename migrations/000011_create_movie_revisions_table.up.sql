@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS movie_revisions (
+    movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+    version integer NOT NULL,
+    operation text NOT NULL CHECK (operation IN ('insert', 'update', 'delete', 'restore')),
+    user_id bigint REFERENCES users ON DELETE SET NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    title text NOT NULL,
+    year integer NOT NULL,
+    runtime integer NOT NULL,
+    genres text[] NOT NULL,
+    PRIMARY KEY (movie_id, version)
+);
+
+-- Give every existing movie a starting revision, so that there's always something to
+-- diff against.
+INSERT INTO movie_revisions (movie_id, version, operation, created_at, title, year, runtime, genres)
+SELECT id, version, 'insert', created_at, title, year, runtime, genres
+FROM movies
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,42 @@
+CREATE TABLE IF NOT EXISTS genres (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    slug text NOT NULL UNIQUE,
+    name text NOT NULL,
+    aliases text[] NOT NULL DEFAULT '{}',
+    version integer NOT NULL DEFAULT 1
+);
+
+CREATE INDEX IF NOT EXISTS genres_aliases_idx ON genres USING GIN (aliases);
+
+-- Seed the taxonomy with every genre already in use. Each spelling is reduced to a
+-- slug of lowercase letters, digits and hyphens, and any spellings which differ from
+-- their slug are kept as aliases of it.
+WITH spellings AS (
+    SELECT DISTINCT genre,
+        trim(both '-' from regexp_replace(lower(genre), '[^a-z0-9]+', '-', 'g')) AS slug
+    FROM movies, unnest(movies.genres) AS genre
+)
+INSERT INTO genres (slug, name, aliases)
+SELECT slug,
+    initcap(replace(slug, '-', ' ')),
+    COALESCE(array_agg(DISTINCT lower(genre)) FILTER (WHERE lower(genre) <> slug), '{}')
+FROM spellings
+WHERE slug <> ''
+GROUP BY slug
+ON CONFLICT (slug) DO NOTHING;
+
+-- Then rewrite the genres of every movie using the slugs, dropping any duplicates that
+-- this creates while keeping the original order.
+UPDATE movies
+SET genres = ARRAY(
+    SELECT slug
+    FROM (
+        SELECT trim(both '-' from regexp_replace(lower(genre), '[^a-z0-9]+', '-', 'g')) AS slug, ord
+        FROM unnest(movies.genres) WITH ORDINALITY AS g (genre, ord)
+    ) AS slugs
+    WHERE slug <> ''
+    GROUP BY slug
+    ORDER BY min(ord)
+)
+WHERE genres IS NOT NULL;
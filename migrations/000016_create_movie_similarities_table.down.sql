@@ -0,0 +1,6 @@
+DROP TRIGGER IF EXISTS lists_movies_similarity_queue ON lists_movies;
+DROP TRIGGER IF EXISTS watchlist_similarity_queue ON watchlist;
+DROP TRIGGER IF EXISTS movies_similarity_queue ON movies;
+DROP FUNCTION IF EXISTS queue_movie_similarity();
+DROP TABLE IF EXISTS movie_similarity_queue;
+DROP TABLE IF EXISTS movie_similarities;
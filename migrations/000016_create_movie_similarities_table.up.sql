@@ -0,0 +1,50 @@
+CREATE TABLE IF NOT EXISTS movie_similarities (
+    movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+    similar_movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+    score double precision NOT NULL,
+    computed_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (movie_id, similar_movie_id)
+);
+
+CREATE INDEX IF NOT EXISTS movie_similarities_score_idx ON movie_similarities (movie_id, score DESC);
+CREATE INDEX IF NOT EXISTS movie_similarities_similar_movie_id_idx ON movie_similarities (similar_movie_id);
+
+-- Movies whose similarities need to be recomputed. Rows are added by the triggers
+-- below and removed by the background job once it has recomputed the movie.
+CREATE TABLE IF NOT EXISTS movie_similarity_queue (
+    movie_id bigint PRIMARY KEY REFERENCES movies ON DELETE CASCADE,
+    queued_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE OR REPLACE FUNCTION queue_movie_similarity() RETURNS trigger AS $$
+BEGIN
+    IF TG_TABLE_NAME = 'movies' THEN
+        INSERT INTO movie_similarity_queue (movie_id) VALUES (NEW.id)
+        ON CONFLICT (movie_id) DO NOTHING;
+    ELSIF TG_OP = 'DELETE' THEN
+        INSERT INTO movie_similarity_queue (movie_id)
+        SELECT id FROM movies WHERE id = OLD.movie_id
+        ON CONFLICT (movie_id) DO NOTHING;
+    ELSE
+        INSERT INTO movie_similarity_queue (movie_id) VALUES (NEW.movie_id)
+        ON CONFLICT (movie_id) DO NOTHING;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER movies_similarity_queue
+AFTER INSERT OR UPDATE OF genres, year, deleted_at ON movies
+FOR EACH ROW EXECUTE FUNCTION queue_movie_similarity();
+
+CREATE TRIGGER watchlist_similarity_queue
+AFTER INSERT OR DELETE ON watchlist
+FOR EACH ROW EXECUTE FUNCTION queue_movie_similarity();
+
+CREATE TRIGGER lists_movies_similarity_queue
+AFTER INSERT OR DELETE ON lists_movies
+FOR EACH ROW EXECUTE FUNCTION queue_movie_similarity();
+
+INSERT INTO movie_similarity_queue (movie_id)
+SELECT id FROM movies WHERE deleted_at IS NULL
+ON CONFLICT (movie_id) DO NOTHING;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS franchises_movies;
+DROP TABLE IF EXISTS franchises;
@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS franchises (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    name text NOT NULL UNIQUE,
+    description text NOT NULL DEFAULT '',
+    version integer NOT NULL DEFAULT 1
+);
+
+CREATE TABLE IF NOT EXISTS franchises_movies (
+    franchise_id bigint NOT NULL REFERENCES franchises ON DELETE CASCADE,
+    movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+    position integer NOT NULL,
+    added_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (franchise_id, movie_id)
+);
+
+CREATE INDEX IF NOT EXISTS franchises_movies_position_idx ON franchises_movies (franchise_id, position);
+CREATE INDEX IF NOT EXISTS franchises_movies_movie_id_idx ON franchises_movies (movie_id);
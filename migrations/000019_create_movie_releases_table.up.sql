@@ -0,0 +1,45 @@
+-- The certifications which can be given to a movie in each country, ranked from the
+-- least to the most restrictive.
+CREATE TABLE IF NOT EXISTS certifications (
+    country text NOT NULL,
+    code text NOT NULL,
+    rank integer NOT NULL,
+    description text NOT NULL DEFAULT '',
+    PRIMARY KEY (country, code),
+    UNIQUE (country, rank)
+);
+
+INSERT INTO certifications (country, code, rank, description) VALUES
+    ('US', 'G', 1, 'General audiences'),
+    ('US', 'PG', 2, 'Parental guidance suggested'),
+    ('US', 'PG-13', 3, 'Parents strongly cautioned'),
+    ('US', 'R', 4, 'Restricted'),
+    ('US', 'NC-17', 5, 'Adults only'),
+    ('GB', 'U', 1, 'Universal'),
+    ('GB', 'PG', 2, 'Parental guidance'),
+    ('GB', '12A', 3, 'Suitable for 12 years and over, or younger with an adult'),
+    ('GB', '12', 4, 'Suitable for 12 years and over'),
+    ('GB', '15', 5, 'Suitable only for 15 years and over'),
+    ('GB', '18', 6, 'Suitable only for adults'),
+    ('GB', 'R18', 7, 'Restricted 18'),
+    ('DE', '0', 1, 'Approved without age restriction'),
+    ('DE', '6', 2, 'Approved for children aged 6 and above'),
+    ('DE', '12', 3, 'Approved for children aged 12 and above'),
+    ('DE', '16', 4, 'Approved for children aged 16 and above'),
+    ('DE', '18', 5, 'Not approved for young persons'),
+    ('FR', 'U', 1, 'Tous publics'),
+    ('FR', '12', 2, 'Interdit aux moins de 12 ans'),
+    ('FR', '16', 3, 'Interdit aux moins de 16 ans'),
+    ('FR', '18', 4, 'Interdit aux moins de 18 ans')
+ON CONFLICT (country, code) DO NOTHING;
+
+CREATE TABLE IF NOT EXISTS movie_releases (
+    movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+    country text NOT NULL,
+    release_date date NOT NULL,
+    certification text,
+    PRIMARY KEY (movie_id, country),
+    FOREIGN KEY (country, certification) REFERENCES certifications (country, code) ON UPDATE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS movie_releases_country_date_idx ON movie_releases (country, release_date);
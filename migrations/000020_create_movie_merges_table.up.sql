@@ -0,0 +1,17 @@
+-- The audit log of duplicate movies merged into other movies. The duplicate is gone
+-- by the time its merge is recorded, so the log keeps a copy of it rather than a
+-- reference, and it outlives the survivor too.
+CREATE TABLE IF NOT EXISTS movie_merges (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    user_id bigint REFERENCES users ON DELETE SET NULL,
+    survivor_id bigint NOT NULL,
+    duplicate_id bigint NOT NULL,
+    duplicate_title text NOT NULL,
+    duplicate_year integer NOT NULL,
+    duplicate_runtime integer NOT NULL,
+    duplicate_genres text[] NOT NULL,
+    moved jsonb NOT NULL DEFAULT '{}'
+);
+
+CREATE INDEX IF NOT EXISTS movie_merges_survivor_id_idx ON movie_merges (survivor_id);
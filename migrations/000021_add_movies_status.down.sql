@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS movies_publish_at_idx;
+ALTER TABLE movies DROP CONSTRAINT IF EXISTS movies_publish_at_check;
+ALTER TABLE movies DROP CONSTRAINT IF EXISTS movies_status_check;
+ALTER TABLE movies DROP COLUMN IF EXISTS publish_at;
+ALTER TABLE movies DROP COLUMN IF EXISTS status;
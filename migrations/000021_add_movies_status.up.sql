@@ -0,0 +1,11 @@
+-- Existing movies were all visible to everyone, so they start out published.
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS status text NOT NULL DEFAULT 'published';
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS publish_at timestamp(0) with time zone;
+
+ALTER TABLE movies ADD CONSTRAINT movies_status_check
+    CHECK (status IN ('draft', 'scheduled', 'published', 'archived'));
+ALTER TABLE movies ADD CONSTRAINT movies_publish_at_check
+    CHECK (status <> 'scheduled' OR publish_at IS NOT NULL);
+
+-- The scheduler only ever looks for scheduled movies which are due.
+CREATE INDEX IF NOT EXISTS movies_publish_at_idx ON movies (publish_at) WHERE status = 'scheduled';
@@ -0,0 +1,2 @@
+DELETE FROM permissions WHERE code = 'movies:moderate';
+DROP TABLE IF EXISTS movie_submissions;
@@ -0,0 +1,26 @@
+-- Movies and edits proposed by users, waiting for a moderator to approve or reject
+-- them. Proposed edits hold the complete movie as it would be after the edit, along
+-- with the version of the movie it was proposed against.
+CREATE TABLE IF NOT EXISTS movie_submissions (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    kind text NOT NULL CHECK (kind IN ('create', 'update')),
+    movie_id bigint REFERENCES movies ON DELETE SET NULL,
+    movie_version integer NOT NULL DEFAULT 0,
+    title text NOT NULL,
+    year integer NOT NULL,
+    runtime integer NOT NULL,
+    genres text[] NOT NULL,
+    status text NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'approved', 'rejected')),
+    reason text NOT NULL DEFAULT '',
+    reviewer_id bigint REFERENCES users ON DELETE SET NULL,
+    reviewed_at timestamp(0) with time zone
+);
+
+CREATE INDEX IF NOT EXISTS movie_submissions_pending_idx ON movie_submissions (created_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS movie_submissions_user_id_idx ON movie_submissions (user_id);
+CREATE INDEX IF NOT EXISTS movie_submissions_movie_id_idx ON movie_submissions (movie_id);
+
+INSERT INTO permissions (code)
+VALUES ('movies:moderate');
@@ -0,0 +1,4 @@
+-- Finding duplicate movies compares titles after lowercasing them and collapsing
+-- punctuation, so the trigram index is built on the same expression.
+CREATE INDEX IF NOT EXISTS movies_normalized_title_trgm_idx ON movies
+    USING GIN (trim(regexp_replace(lower(title), '[^[:alnum:]]+', ' ', 'g')) gin_trgm_ops);